@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/twilio/twilio-go"
+	"github.com/twilio/twilio-go/client"
+)
+
+// twilioAccount is one named Twilio account a message can be pinned to
+type twilioAccount struct {
+	config TwilioConfig
+	client *twilio.RestClient
+}
+
+// twilioAccountEntry is one account of TWILIO_ACCOUNTS or TWILIO_ACCOUNTS_FILE
+type twilioAccountEntry struct {
+	AccountSID       string `json:"account_sid"`
+	AuthToken        string `json:"auth_token"`
+	FromNumber       string `json:"from_number"`
+	MessagingService string `json:"messaging_service_sid"`
+}
+
+// twilioAccounts holds the extra accounts by name; messages without an account use the
+// TWILIO_* account in twilioConfig and twilioClient
+var twilioAccounts = map[string]twilioAccount{}
+
+// defaultAccountName names the TWILIO_* account in TWILIO_FALLBACK_ACCOUNTS and sent_via
+const defaultAccountName = "default"
+
+// twilioFallbackAccounts are tried in order when a message's own account fails with a retryable
+// error, from TWILIO_FALLBACK_ACCOUNTS
+var twilioFallbackAccounts []string
+
+// errUnknownAccount fails a send whose account was removed from the configuration after scheduling
+var errUnknownAccount = errors.New("twilio account is not configured")
+
+// newTwilioClient builds a REST client for one account. twilio-go has no context-aware
+// CreateMessage, so each call is bounded through the HTTP client's timeout instead.
+func newTwilioClient(config TwilioConfig) *twilio.RestClient {
+	httpClient := &client.Client{
+		Credentials: client.NewCredentials(config.AccountSID, config.AuthToken),
+	}
+	httpClient.SetAccountSid(config.AccountSID)
+	httpClient.SetTimeout(getEnvDuration("TWILIO_TIMEOUT", 10*time.Second))
+
+	restClient := twilio.NewRestClientWithParams(twilio.ClientParams{
+		Client: httpClient,
+	})
+	// Unset keeps Twilio's default US1 region; e.g. TWILIO_REGION=ie1 TWILIO_EDGE=dublin for the EU
+	if region := os.Getenv("TWILIO_REGION"); region != "" {
+		restClient.SetRegion(region)
+	}
+	if edge := os.Getenv("TWILIO_EDGE"); edge != "" {
+		restClient.SetEdge(edge)
+	}
+	return restClient
+}
+
+// loadTwilioAccounts reads named accounts from the TWILIO_ACCOUNTS JSON object, or from the
+// file at TWILIO_ACCOUNTS_FILE, e.g. {"acme": {"account_sid": "AC...", "auth_token": "...",
+// "from_number": "+1..."}}. Each account shares the status callback of the default one.
+func loadTwilioAccounts() {
+	raw := []byte(os.Getenv("TWILIO_ACCOUNTS"))
+	if path := os.Getenv("TWILIO_ACCOUNTS_FILE"); path != "" {
+		var err error
+		if raw, err = os.ReadFile(path); err != nil {
+			log.Fatalf("Failed to read TWILIO_ACCOUNTS_FILE: %v", err)
+		}
+	}
+	if len(raw) == 0 {
+		return
+	}
+
+	var entries map[string]twilioAccountEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		log.Fatalf("TWILIO_ACCOUNTS must be a JSON object of named accounts: %v", err)
+	}
+	for name, entry := range entries {
+		if name == "" || name == defaultAccountName {
+			log.Fatalf("TWILIO_ACCOUNTS account names must not be empty or %q", defaultAccountName)
+		}
+		if entry.AccountSID == "" || entry.AuthToken == "" {
+			log.Fatalf("Twilio account %q needs account_sid and auth_token", name)
+		}
+		if entry.FromNumber == "" && entry.MessagingService == "" {
+			log.Fatalf("Twilio account %q needs from_number or messaging_service_sid", name)
+		}
+
+		config := TwilioConfig{
+			AccountSID:        entry.AccountSID,
+			AuthToken:         entry.AuthToken,
+			FromNumber:        entry.FromNumber,
+			MessagingService:  entry.MessagingService,
+			StatusCallbackURL: twilioConfig.StatusCallbackURL,
+		}
+		twilioAccounts[name] = twilioAccount{config: config, client: newTwilioClient(config)}
+	}
+	log.Printf("Loaded %d named Twilio accounts", len(twilioAccounts))
+}
+
+// loadFallbackAccounts reads TWILIO_FALLBACK_ACCOUNTS, a comma-separated list of account names
+// where default is the TWILIO_* account, e.g. "backup,default"
+func loadFallbackAccounts() {
+	for _, name := range strings.Split(os.Getenv("TWILIO_FALLBACK_ACCOUNTS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := twilioAccounts[name]; !ok && name != defaultAccountName {
+			log.Fatalf("TWILIO_FALLBACK_ACCOUNTS names unknown Twilio account %q", name)
+		}
+		twilioFallbackAccounts = append(twilioFallbackAccounts, name)
+	}
+	if len(twilioFallbackAccounts) > 0 {
+		log.Printf("Sends fail over to Twilio accounts %s", strings.Join(twilioFallbackAccounts, ", "))
+	}
+}
+
+// validateAccount checks the optional account of a schedule request
+func validateAccount(name string) *apiError {
+	if name == "" {
+		return nil
+	}
+	if _, ok := twilioAccounts[name]; !ok {
+		names := make([]string, 0, len(twilioAccounts))
+		for known := range twilioAccounts {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return &apiError{Code: codeUnknownAccount, Message: fmt.Sprintf("Unknown Twilio account %q", name), Details: gin.H{"accounts": names}}
+	}
+	return nil
+}
+
+// accountFor returns the Twilio account a message is sent through, or for a sent message the
+// account that accepted it
+func accountFor(message *Message) (TwilioConfig, *twilio.RestClient, error) {
+	if message.SentVia != "" {
+		return accountNamed(message.SentVia)
+	}
+	return accountNamed(message.Account)
+}
+
+// accountNamed returns a Twilio account by name; empty or default is the TWILIO_* account
+func accountNamed(name string) (TwilioConfig, *twilio.RestClient, error) {
+	if name == "" || name == defaultAccountName {
+		return twilioConfig, twilioClient, nil
+	}
+	account, ok := twilioAccounts[name]
+	if !ok {
+		return TwilioConfig{}, nil, fmt.Errorf("%w: %s", errUnknownAccount, name)
+	}
+	return account.config, account.client, nil
+}
+
+// sendChain lists the accounts a message is tried on: its own, then the fallbacks
+func sendChain(message Message) []string {
+	primary := message.Account
+	if primary == "" {
+		primary = defaultAccountName
+	}
+	chain := []string{primary}
+	for _, name := range twilioFallbackAccounts {
+		if !slices.Contains(chain, name) {
+			chain = append(chain, name)
+		}
+	}
+	return chain
+}
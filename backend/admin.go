@@ -0,0 +1,185 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm/clause"
+)
+
+// Setting is a persisted key/value pair for runtime switches that must survive restarts
+type Setting struct {
+	Key       string    `json:"key" gorm:"primaryKey"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const sendingPausedSetting = "sending_paused"
+
+// sendingPaused stops sendDueMessages from sending while set; messages stay pending
+var sendingPaused atomic.Bool
+
+// loadSendingPaused restores the pause flag persisted by a previous run
+func loadSendingPaused() {
+	var setting Setting
+	if err := db.Where("key = ?", sendingPausedSetting).Limit(1).Find(&setting).Error; err != nil {
+		log.Fatal("Failed to load pause state:", err)
+	}
+
+	paused, _ := strconv.ParseBool(setting.Value)
+	sendingPaused.Store(paused)
+	if paused {
+		log.Println("Sending is paused; resume with POST /api/admin/resume")
+	}
+}
+
+func setSendingPaused(c *gin.Context, paused bool) {
+	setting := Setting{Key: sendingPausedSetting, Value: strconv.FormatBool(paused), UpdatedAt: time.Now().UTC()}
+	err := db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&setting).Error
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to persist pause state")
+		return
+	}
+
+	sendingPaused.Store(paused)
+	log.Printf("Sending paused: %t", paused)
+
+	respond(c, http.StatusOK, gin.H{"sending_paused": paused})
+}
+
+func pauseSending(c *gin.Context) {
+	setSendingPaused(c, true)
+}
+
+func resumeSending(c *gin.Context) {
+	setSendingPaused(c, false)
+}
+
+// processNowDefaultLimit caps a manual pass when no limit is given. Sends are rate limited to
+// one per second and the response waits for all of them, so large passes outlast HTTP_WRITE_TIMEOUT.
+const processNowDefaultLimit = 30
+
+// processNow runs one processing pass immediately instead of waiting for the next tick,
+// e.g. to flush the queue after resuming. Only the oldest limit due messages are worked.
+func processNow(c *gin.Context) {
+	limit := processNowDefaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, "limit must be a positive integer")
+			return
+		}
+		limit = parsed
+	}
+	if sendingPaused.Load() {
+		respondErrorCode(c, http.StatusConflict, codeSendingPaused, "Sending is paused; resume it before processing")
+		return
+	}
+	if !processorRun.TryLock() {
+		respondErrorCode(c, http.StatusConflict, codeProcessorBusy, "A processing pass is already running")
+		return
+	}
+	processed := sendDueMessages(limit)
+	processorRun.Unlock()
+
+	results := make([]gin.H, 0, len(processed))
+	counts := make(map[string]int)
+	for _, message := range processed {
+		result := gin.H{"id": message.ID, "status": message.Status}
+		if message.LastError != "" {
+			result["error"] = message.LastError
+		}
+		results = append(results, result)
+		counts[message.Status]++
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"attempted": len(processed),
+		"by_status": counts,
+		"results":   results,
+	})
+}
+
+// schedulerEntry describes one registered cron entry for the scheduler dump
+type schedulerEntry struct {
+	EntryID     int        `json:"entry_id"`
+	Job         string     `json:"job"`                    // "recurring" or a housekeeping job name
+	RecurringID *uint      `json:"recurring_id,omitempty"` // the recurring message a "recurring" entry fires
+	Next        *time.Time `json:"next"`
+	Prev        *time.Time `json:"prev"`
+}
+
+// getSchedulerEntries dumps the cron entries the scheduler holds and what they run
+func getSchedulerEntries(c *gin.Context) {
+	recurringEntriesMu.Lock()
+	recurringByEntry := make(map[cron.EntryID]uint, len(recurringEntries))
+	for id, entryID := range recurringEntries {
+		recurringByEntry[entryID] = id
+	}
+	recurringEntriesMu.Unlock()
+
+	systemJobsMu.Lock()
+	names := make(map[cron.EntryID]string, len(systemJobs))
+	for entryID, name := range systemJobs {
+		names[entryID] = name
+	}
+	systemJobsMu.Unlock()
+
+	entries := []schedulerEntry{}
+	for _, entry := range scheduler.Entries() {
+		item := schedulerEntry{EntryID: int(entry.ID), Job: "unknown"}
+		if id, ok := recurringByEntry[entry.ID]; ok {
+			item.Job = "recurring"
+			item.RecurringID = &id
+		} else if name, ok := names[entry.ID]; ok {
+			item.Job = name
+		}
+		if !entry.Next.IsZero() {
+			next := entry.Next.UTC()
+			item.Next = &next
+		}
+		if !entry.Prev.IsZero() {
+			prev := entry.Prev.UTC()
+			item.Prev = &prev
+		}
+		entries = append(entries, item)
+	}
+
+	respond(c, http.StatusOK, entries)
+}
+
+// healthz reports whether the service can reach its database, plus operational state
+func healthz(c *gin.Context) {
+	health := gin.H{
+		"status":          "ok",
+		"sending_paused":  sendingPaused.Load(),
+		"circuit_breaker": twilioBreaker.State(),
+	}
+	if balance, ok := lastTwilioBalance(); ok {
+		health["twilio_balance"] = balance
+	}
+	processor, processorStale := processorHealth()
+	health["processor"] = processor
+
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.Ping()
+	}
+	if err != nil {
+		health["status"] = "unavailable"
+		respondAPIError(c, http.StatusServiceUnavailable, &apiError{Message: "Database unavailable: " + err.Error(), Details: health})
+		return
+	}
+	if processorStale {
+		health["status"] = "degraded"
+		respondAPIError(c, http.StatusServiceUnavailable, &apiError{Message: "Message processor has not completed a run recently", Details: health})
+		return
+	}
+
+	respond(c, http.StatusOK, health)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// failureAlerter watches the ratio of failed send attempts over a rolling window and posts
+// to ALERT_WEBHOOK_URL when it crosses the threshold. It fires once per incident and posts a
+// resolution once the ratio drops back below the threshold.
+type failureAlerter struct {
+	webhookURL string
+	threshold  float64       // failed/attempted ratio that opens an incident, from FAILURE_ALERT_THRESHOLD
+	window     time.Duration // how far back attempts count, from FAILURE_ALERT_WINDOW
+	minSends   int           // attempts needed in the window before the ratio means anything
+
+	mu       sync.Mutex
+	attempts []sendOutcome // oldest first
+	firing   bool
+}
+
+type sendOutcome struct {
+	at     time.Time
+	failed bool
+}
+
+// sendAlerts is nil unless both ALERT_WEBHOOK_URL and FAILURE_ALERT_THRESHOLD are set
+var sendAlerts *failureAlerter
+
+func loadFailureAlerter() {
+	webhookURL := os.Getenv("ALERT_WEBHOOK_URL")
+	threshold := getEnvFloat("FAILURE_ALERT_THRESHOLD", 0)
+	if webhookURL == "" || threshold <= 0 {
+		return
+	}
+	if threshold > 1 {
+		log.Fatal("FAILURE_ALERT_THRESHOLD is a ratio of failed sends; use a value such as 0.25")
+	}
+
+	sendAlerts = &failureAlerter{
+		webhookURL: webhookURL,
+		threshold:  threshold,
+		window:     getEnvDuration("FAILURE_ALERT_WINDOW", 10*time.Minute),
+		minSends:   max(getEnvInt("FAILURE_ALERT_MIN_SENDS", 10), 1),
+	}
+}
+
+// record adds one send attempt's outcome and opens or resolves the incident as needed
+func (a *failureAlerter) record(failed bool) {
+	if a == nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	a.mu.Lock()
+	a.attempts = append(a.attempts, sendOutcome{at: now, failed: failed})
+	cutoff := now.Add(-a.window)
+	for len(a.attempts) > 0 && a.attempts[0].at.Before(cutoff) {
+		a.attempts = a.attempts[1:]
+	}
+
+	failures := 0
+	for _, attempt := range a.attempts {
+		if attempt.failed {
+			failures++
+		}
+	}
+	total := len(a.attempts)
+	ratio := float64(failures) / float64(total)
+
+	var text string
+	switch {
+	case !a.firing && total >= a.minSends && ratio >= a.threshold:
+		a.firing = true
+		text = fmt.Sprintf(":rotating_light: SMS send failures at %.0f%% (%d of %d attempts in the last %s), above the %.0f%% threshold",
+			ratio*100, failures, total, a.window, a.threshold*100)
+	case a.firing && ratio < a.threshold:
+		a.firing = false
+		text = fmt.Sprintf(":white_check_mark: SMS send failures back to %.0f%% (%d of %d attempts in the last %s)",
+			ratio*100, failures, total, a.window)
+	}
+	a.mu.Unlock()
+
+	if text != "" {
+		log.Printf("Failure alert: %s", text)
+		go a.post(text)
+	}
+}
+
+// post delivers a Slack-compatible {"text": ...} payload
+func (a *failureAlerter) post(text string) {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		log.Printf("Failed to encode failure alert: %v", err)
+		return
+	}
+
+	resp, err := webhookHTTPClient.Post(a.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to deliver failure alert: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("Failure alert webhook returned %s", resp.Status)
+	}
+}
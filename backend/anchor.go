@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseOffset reads an anchor offset: a Go duration such as 36h or 90m, or whole days such as 7d.
+// Negative offsets schedule before the anchor.
+func parseOffset(raw string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err == nil
+	}
+	offset, err := time.ParseDuration(raw)
+	return offset, err == nil
+}
+
+// resolveAnchoredTime computes scheduled_at = anchor_at + offset for a lifecycle message.
+// A computed time already in the past is not an error: passed reports it so the message can
+// be stored as expired, keeping a record of recipients whose window was missed.
+func resolveAnchoredTime(req *ScheduleMessageRequest) (scheduledAt time.Time, passed bool, apiErr *apiError) {
+	if req.ScheduledAt != "" {
+		return time.Time{}, false, &apiError{Code: codeInvalidParameter, Message: "Give either scheduled_at or anchor_at with offset, not both"}
+	}
+	if req.AnchorAt == "" || req.Offset == "" {
+		return time.Time{}, false, &apiError{Code: codeInvalidParameter, Message: "anchor_at and offset must be given together"}
+	}
+
+	anchorAt, apiErr := parseSendTime(req.AnchorAt, req.Timezone)
+	if apiErr != nil {
+		if apiErr.Code == codeInvalidDate {
+			apiErr.Message = "Invalid anchor_at date. Use ISO 8601 format."
+		}
+		return time.Time{}, false, apiErr
+	}
+	offset, ok := parseOffset(req.Offset)
+	if !ok {
+		return time.Time{}, false, &apiError{Code: codeInvalidDuration, Message: "offset must be a duration such as 36h, or whole days such as 7d"}
+	}
+
+	scheduledAt, passed = applyScheduleGrace(anchorAt.Add(offset).UTC())
+	if passed {
+		return scheduledAt, true, nil
+	}
+	if apiErr := checkScheduleHorizon(scheduledAt); apiErr != nil {
+		return time.Time{}, false, apiErr
+	}
+	return scheduledAt, false, nil
+}
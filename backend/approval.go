@@ -0,0 +1,149 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// approvalRequired holds new messages in pending_approval until an approver releases them,
+// from APPROVAL_REQUIRED. sendDueMessages only ever picks up pending messages.
+var approvalRequired bool
+
+// approverKeys maps each API key allowed to approve or reject messages to the approver's
+// name, recorded on the message, from APPROVER_KEYS
+var approverKeys map[string]string
+
+// queuedStatuses are the statuses of messages waiting to be sent, approved or not yet
+var queuedStatuses = []string{"pending", "pending_approval"}
+
+// loadApprovalConfig reads APPROVAL_REQUIRED and APPROVER_KEYS, a comma-separated list of
+// key:name pairs. Approver keys also need an API_KEYS entry when authentication is enabled.
+func loadApprovalConfig() {
+	approvalRequired = getEnvBool("APPROVAL_REQUIRED", false)
+	approverKeys = make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("APPROVER_KEYS"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, name, ok := strings.Cut(pair, ":")
+		if !ok || key == "" || name == "" {
+			log.Fatalf("Invalid APPROVER_KEYS entry %q. Use key:name pairs separated by commas", pair)
+		}
+		approverKeys[key] = name
+	}
+	if approvalRequired && len(approverKeys) == 0 {
+		log.Fatal("APPROVAL_REQUIRED needs at least one approver in APPROVER_KEYS")
+	}
+}
+
+// queuedStatus is the status a message ready to go out is stored with
+func queuedStatus() string {
+	if approvalRequired {
+		return "pending_approval"
+	}
+	return "pending"
+}
+
+// approverName returns the approver behind the request's API key, if it is one
+func approverName(c *gin.Context) (string, bool) {
+	name, ok := approverKeys[requestAPIKey(c)]
+	return name, ok
+}
+
+// RejectMessageRequest says why a message was turned down
+type RejectMessageRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+func approveMessage(c *gin.Context) {
+	reviewMessage(c, "pending", "")
+}
+
+func rejectMessage(c *gin.Context) {
+	var req RejectMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+		return
+	}
+	reviewMessage(c, "rejected", req.Reason)
+}
+
+// reviewMessage moves a pending_approval message to pending or rejected, recording the approver
+func reviewMessage(c *gin.Context, status, reason string) {
+	approver, ok := approverName(c)
+	if !ok {
+		respondErrorCode(c, http.StatusForbidden, codeNotApprover, "This API key may not approve or reject messages")
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidMessageID, "Invalid message ID")
+		return
+	}
+	var message Message
+	if err := db.Scopes(forTenant(c)).First(&message, uint(id)).Error; err != nil {
+		respondErrorCode(c, http.StatusNotFound, codeMessageNotFound, "Message not found")
+		return
+	}
+	if message.Status != "pending_approval" {
+		respondErrorCode(c, http.StatusConflict, codeNotPendingApproval, "Message is not awaiting approval")
+		return
+	}
+	if status == "pending" {
+		// A second pair of eyes is the point of approval; the creator may still reject (withdraw)
+		if message.CreatedBy != "" && message.CreatedBy == requestActor(c) {
+			respondErrorCode(c, http.StatusForbidden, codeSelfApproval, "Messages cannot be approved with the API key that created them")
+			return
+		}
+		if apiErr := attachConsent(&message); apiErr != nil {
+			respondAPIError(c, consentErrorStatus(apiErr), apiErr)
+			return
+		}
+		if !checkBackpressure(c, 1) {
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	result := db.Model(&Message{}).
+		Where("id = ? AND status = ?", message.ID, "pending_approval").
+		Updates(map[string]interface{}{
+			"status":            status,
+			"reviewed_by":       approver,
+			"reviewed_at":       now,
+			"rejection_reason":  reason,
+			"consent_id":        message.ConsentID,
+			"status_updated_at": now,
+			"updated_at":        now,
+		})
+	if result.Error != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to review message")
+		return
+	}
+	if result.RowsAffected == 0 {
+		respondErrorCode(c, http.StatusConflict, codeNotPendingApproval, "Message is no longer awaiting approval")
+		return
+	}
+
+	message.Status = status
+	message.ReviewedBy = approver
+	message.ReviewedAt = &now
+	message.RejectionReason = reason
+	message.StatusUpdatedAt = &now
+	message.UpdatedAt = now
+	publishStatusChange(message, "pending_approval")
+
+	if message.Status == "pending" {
+		estimate := estimatedSendAt(message.ScheduledAt)
+		message.EstimatedSendAt = &estimate
+	}
+	respond(c, http.StatusOK, message)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reviewAs runs an approval of the message with the given API key and returns the response
+func reviewAs(t *testing.T, key string, id uint) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/messages/"+strconv.Itoa(int(id))+"/approve", nil)
+	c.Request.Header.Set("X-API-Key", key)
+	c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(int(id))}}
+	approveMessage(c)
+	return recorder
+}
+
+func TestApproveRefusesCreatingKey(t *testing.T) {
+	useTestDB(t)
+	gin.SetMode(gin.TestMode)
+	previousKeys, previousInterval := approverKeys, processorInterval
+	approverKeys = map[string]string{"key-alice": "alice", "key-bob": "bob"}
+	processorInterval = 30 * time.Second // approving estimates the send tick
+	t.Cleanup(func() { approverKeys, processorInterval = previousKeys, previousInterval })
+
+	// The message is created with alice's key, as newMessage records it
+	created := httptest.NewRequest(http.MethodPost, "/api/schedule", nil)
+	created.Header.Set("X-API-Key", "key-alice")
+	now := time.Now().UTC()
+	message := Message{
+		PhoneNumber: "+15551230001",
+		Content:     "hi",
+		Status:      "pending_approval",
+		CreatedBy:   requestActor(&gin.Context{Request: created}),
+		ScheduledAt: now.Add(time.Hour),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := db.Create(&message).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := reviewAs(t, "key-alice", message.ID)
+	var body struct {
+		Error apiError `json:"error"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &body)
+	if recorder.Code != http.StatusForbidden || body.Error.Code != codeSelfApproval {
+		t.Fatalf("self-approval = %d %s, want %d %s", recorder.Code, body.Error.Code, http.StatusForbidden, codeSelfApproval)
+	}
+
+	if recorder := reviewAs(t, "key-bob", message.ID); recorder.Code != http.StatusOK {
+		t.Fatalf("approval by another approver = %d: %s", recorder.Code, recorder.Body)
+	}
+	var stored Message
+	if err := db.First(&stored, message.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "pending" || stored.ReviewedBy != "bob" {
+		t.Errorf("approved message = %s reviewed by %q, want pending by bob", stored.Status, stored.ReviewedBy)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const archiveBatchSize = 1000
+
+// archiveStore receives archived message batches as newline-delimited JSON objects
+type archiveStore interface {
+	Upload(key string, body []byte) error
+}
+
+// archivedMessage is the archived form of a message; unlike the API it keeps the tenant
+type archivedMessage struct {
+	Message
+	TenantID string `json:"tenant_id"`
+}
+
+// registerArchiveJob schedules the archive export on ARCHIVE_CRON when ARCHIVE_STORE is set.
+// Messages in a terminal status last updated more than ARCHIVE_AFTER_DAYS ago are exported,
+// and with ARCHIVE_PRUNE also deleted once their batch is uploaded.
+func registerArchiveJob() {
+	kind := os.Getenv("ARCHIVE_STORE")
+	if kind == "" {
+		return
+	}
+
+	var store archiveStore
+	switch kind {
+	case "file":
+		dir := getEnvString("ARCHIVE_DIR", "archive")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Fatalf("Failed to create archive directory %s: %v", dir, err)
+		}
+		store = fileArchiveStore{dir: dir}
+	case "s3":
+		s3, err := loadS3ArchiveStore()
+		if err != nil {
+			log.Fatal("Invalid S3 archive configuration: ", err)
+		}
+		store = s3
+	default:
+		log.Fatalf("Unknown ARCHIVE_STORE %q; use file or s3", kind)
+	}
+
+	afterDays := getEnvInt("ARCHIVE_AFTER_DAYS", 30)
+	prune := getEnvBool("ARCHIVE_PRUNE", false)
+	spec := getEnvString("ARCHIVE_CRON", "0 3 * * *")
+	err := registerSystemJob("archive", spec, func() { archiveMessages(store, afterDays, prune) })
+	if err != nil {
+		log.Fatalf("Invalid ARCHIVE_CRON %q: %v", spec, err)
+	}
+}
+
+// archiveMessages uploads old terminal messages in batches, pruning each batch after its upload succeeds
+func archiveMessages(store archiveStore, afterDays int, prune bool) {
+	cutoff := time.Now().UTC().AddDate(0, 0, -afterDays)
+	runKey := time.Now().UTC().Format("20060102T150405Z")
+
+	var archived, pruned int64
+	batchNo := 0
+	var batch []Message
+	result := db.Where("status IN ? AND updated_at < ?", terminalStatuses, cutoff).
+		FindInBatches(&batch, archiveBatchSize, func(tx *gorm.DB, _ int) error {
+			batchNo++
+			var body bytes.Buffer
+			encoder := json.NewEncoder(&body)
+			ids := make([]uint, 0, len(batch))
+			for _, message := range batch {
+				if err := encoder.Encode(archivedMessage{Message: message, TenantID: message.TenantID}); err != nil {
+					return err
+				}
+				ids = append(ids, message.ID)
+			}
+
+			key := fmt.Sprintf("messages-%s-%04d.jsonl", runKey, batchNo)
+			if err := store.Upload(key, body.Bytes()); err != nil {
+				return fmt.Errorf("upload %s: %w", key, err)
+			}
+			archived += int64(len(batch))
+
+			if prune {
+				deleted := db.Where("id IN ?", ids).Delete(&Message{})
+				if deleted.Error != nil {
+					return fmt.Errorf("prune after %s: %w", key, deleted.Error)
+				}
+				pruned += deleted.RowsAffected
+			}
+			return nil
+		})
+	if result.Error != nil {
+		log.Printf("Archive run stopped after %d messages: %v", archived, result.Error)
+		return
+	}
+
+	log.Printf("Archived %d messages older than %s (pruned %d)", archived, cutoff.Format(time.RFC3339), pruned)
+}
+
+// fileArchiveStore writes archive batches into a local directory
+type fileArchiveStore struct {
+	dir string
+}
+
+func (s fileArchiveStore) Upload(key string, body []byte) error {
+	return os.WriteFile(filepath.Join(s.dir, key), body, 0o644)
+}
+
+// s3ArchiveStore uploads archive batches to an S3 (or S3-compatible) bucket with signed
+// path-style PUT requests
+type s3ArchiveStore struct {
+	s3Bucket
+}
+
+func loadS3ArchiveStore() (s3ArchiveStore, error) {
+	bucket, err := loadS3Bucket("ARCHIVE")
+	return s3ArchiveStore{bucket}, err
+}
+
+func (s s3ArchiveStore) Upload(key string, body []byte) error {
+	target, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+	return nil
+}
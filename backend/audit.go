@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditHTTP logs every mutating request with its response, from AUDIT_HTTP
+var auditHTTP bool
+
+// auditBodyLimit caps how much of a request or response body an audit record keeps
+const auditBodyLimit = 64 << 10
+
+// auditSecretFields are substrings of field names whose values are never logged, such as the
+// secret returned by webhook secret rotation
+var auditSecretFields = []string{"secret", "token", "password"}
+
+// auditPhonePattern matches string values that look like phone numbers, whatever their field name
+var auditPhonePattern = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
+// httpAuditRecord is one line of the HTTP audit log
+type httpAuditRecord struct {
+	Time      time.Time   `json:"time"`
+	Method    string      `json:"method"`
+	Path      string      `json:"path"`
+	Actor     string      `json:"actor"` // tenant of the API key; empty without API_KEYS or for the Twilio webhook
+	ClientIP  string      `json:"client_ip"`
+	Status    int         `json:"status"`
+	LatencyMS int64       `json:"latency_ms"`
+	Request   interface{} `json:"request,omitempty"`
+	Response  interface{} `json:"response,omitempty"`
+}
+
+// auditResponseWriter keeps a copy of the response body as it is written
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	if room := auditBodyLimit - w.body.Len(); room > 0 {
+		w.body.Write(data[:min(len(data), room)])
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// auditHTTPRequests writes an AUDIT log line for each POST, PUT, PATCH and DELETE request.
+// Phone numbers are masked and secrets redacted in both bodies; this is separate from any
+// domain-level history.
+func auditHTTPRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auditHTTP || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		var requestBody []byte
+		if c.Request.Body != nil {
+			// Only the first auditBodyLimit bytes are buffered; the handler reads them back
+			// followed by the rest of the stream, so large uploads are not held in memory
+			requestBody, _ = io.ReadAll(io.LimitReader(c.Request.Body, auditBodyLimit))
+			c.Request.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(requestBody), c.Request.Body), c.Request.Body}
+		}
+		writer := &auditResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		record := httpAuditRecord{
+			Time:      start.UTC(),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Actor:     tenantID(c),
+			ClientIP:  c.ClientIP(),
+			Status:    writer.Status(),
+			LatencyMS: time.Since(start).Milliseconds(),
+			Request:   auditBody(c.ContentType(), requestBody),
+			Response:  auditBody(writer.Header().Get("Content-Type"), writer.body.Bytes()),
+		}
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			log.Printf("Failed to encode audit record for %s %s: %v", record.Method, record.Path, err)
+			return
+		}
+		log.Printf("AUDIT %s", encoded)
+	}
+}
+
+// auditBody decodes a JSON or form body with its phone numbers masked. Other bodies, such as
+// CSV uploads, and bodies over auditBodyLimit are summarized by size instead of logged.
+func auditBody(contentType string, body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	summary := fmt.Sprintf("[%d bytes of %s not logged]", len(body), contentType)
+	if len(body) >= auditBodyLimit {
+		return fmt.Sprintf("[%d bytes or more of %s not logged]", auditBodyLimit, contentType)
+	}
+
+	switch {
+	case strings.Contains(contentType, "json"):
+		var generic interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if decoder.Decode(&generic) != nil {
+			return summary
+		}
+		return auditMask(generic)
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return summary
+		}
+		fields := make(map[string]interface{}, len(values))
+		for key, list := range values {
+			if auditSecretField(key) {
+				fields[key] = "[redacted]"
+				continue
+			}
+			masked := make([]interface{}, len(list))
+			for i, value := range list {
+				masked[i] = auditMask(value)
+			}
+			fields[key] = masked
+		}
+		return fields
+	}
+	return summary
+}
+
+// auditMask masks every string that looks like a phone number and redacts secret fields,
+// however deeply nested
+func auditMask(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if auditPhonePattern.MatchString(v) {
+			return maskPhoneNumber(v)
+		}
+	case map[string]interface{}:
+		for key, field := range v {
+			if auditSecretField(key) {
+				v[key] = "[redacted]"
+				continue
+			}
+			v[key] = auditMask(field)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = auditMask(item)
+		}
+	}
+	return value
+}
+
+// auditSecretField reports whether a field's value must be redacted from the audit log
+func auditSecretField(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range auditSecretFields {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const tenantContextKey = "tenant_id"
+
+// apiKeys maps each configured API key to the tenant it authenticates as.
+// When empty, authentication is disabled and every request uses the default tenant.
+var apiKeys map[string]string
+
+// loadAPIKeys parses API_KEYS, a comma-separated list of key:tenant pairs
+func loadAPIKeys() map[string]string {
+	keys := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, tenant, ok := strings.Cut(pair, ":")
+		if !ok || key == "" || tenant == "" {
+			log.Fatalf("Invalid API_KEYS entry %q. Use key:tenant pairs separated by commas", pair)
+		}
+		keys[key] = tenant
+	}
+	return keys
+}
+
+// apiKeyAuth resolves the caller's tenant from the X-API-Key or Bearer Authorization header
+func apiKeyAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(apiKeys) == 0 {
+			c.Set(tenantContextKey, "")
+			c.Next()
+			return
+		}
+
+		tenant, ok := apiKeys[requestAPIKey(c)]
+		if !ok {
+			respondErrorCode(c, http.StatusUnauthorized, codeInvalidAPIKey, "Invalid or missing API key")
+			return
+		}
+
+		c.Set(tenantContextKey, tenant)
+		c.Next()
+	}
+}
+
+// adminKeys are the keys allowed on the operator endpoints under /api/admin, from ADMIN_API_KEYS.
+// They are separate from API_KEYS so no tenant key can pause sending or drain other tenants' queues.
+var adminKeys map[string]bool
+
+// loadAdminKeys parses ADMIN_API_KEYS, a comma-separated list of keys
+func loadAdminKeys() map[string]bool {
+	keys := make(map[string]bool)
+	for _, key := range strings.Split(os.Getenv("ADMIN_API_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// adminAuth admits only ADMIN_API_KEYS holders. With neither API_KEYS nor ADMIN_API_KEYS set,
+// authentication is disabled altogether and admin endpoints are open like every other one.
+func adminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(adminKeys) == 0 && len(apiKeys) == 0 {
+			c.Next()
+			return
+		}
+
+		if !adminKeys[requestAPIKey(c)] {
+			respondErrorCode(c, http.StatusForbidden, codeNotAdmin, "Admin endpoints need a key from ADMIN_API_KEYS")
+			return
+		}
+		c.Next()
+	}
+}
+
+// requestAPIKey returns the key from the X-API-Key or Bearer Authorization header
+func requestAPIKey(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	return strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+}
+
+// requestActor identifies the API key behind a request without storing the key itself, so
+// the key that created a message can be recognised later; empty for requests without a key
+func requestActor(c *gin.Context) string {
+	key := requestAPIKey(c)
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:8])
+}
+
+// tenantID returns the authenticated tenant for the request
+func tenantID(c *gin.Context) string {
+	return c.GetString(tenantContextKey)
+}
+
+// forTenant scopes a query to the authenticated tenant's messages
+func forTenant(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	tenant := tenantID(c)
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("tenant_id = ?", tenant)
+	}
+}
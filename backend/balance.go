@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	api "github.com/twilio/twilio-go/rest/api/v2010"
+)
+
+// twilioBalance is the account balance as of the last successful check
+type twilioBalance struct {
+	Balance   float64   `json:"balance"`
+	Currency  string    `json:"currency"`
+	Low       bool      `json:"low"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+var latestBalance *twilioBalance
+var latestBalanceMu sync.Mutex
+
+// startBalanceMonitor polls the Twilio balance every interval, warning once it drops
+// below minBalance. A zero interval disables the checks; a zero minBalance only records it.
+func startBalanceMonitor(interval time.Duration, minBalance float64) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			checkTwilioBalance(minBalance)
+			<-ticker.C
+		}
+	}()
+}
+
+func checkTwilioBalance(minBalance float64) {
+	resp, err := twilioClient.Api.FetchBalance(&api.FetchBalanceParams{})
+	if err != nil {
+		log.Printf("Failed to fetch Twilio balance: %v", err)
+		return
+	}
+	if resp.Balance == nil {
+		log.Println("Twilio returned no balance")
+		return
+	}
+	amount, err := strconv.ParseFloat(*resp.Balance, 64)
+	if err != nil {
+		log.Printf("Unparseable Twilio balance %q: %v", *resp.Balance, err)
+		return
+	}
+
+	balance := &twilioBalance{Balance: amount, CheckedAt: time.Now().UTC()}
+	if resp.Currency != nil {
+		balance.Currency = *resp.Currency
+	}
+	balance.Low = minBalance > 0 && amount < minBalance
+
+	latestBalanceMu.Lock()
+	wasLow := latestBalance != nil && latestBalance.Low
+	latestBalance = balance
+	latestBalanceMu.Unlock()
+
+	if !balance.Low {
+		return
+	}
+	log.Printf("WARNING: Twilio balance %.2f %s is below MIN_BALANCE %.2f; sends will fail once credit runs out",
+		amount, balance.Currency, minBalance)
+	// Alert the webhook only when the balance first drops, not on every check
+	if !wasLow {
+		publishEvent(StatusEvent{
+			Type:       "low_balance",
+			Balance:    &amount,
+			Currency:   balance.Currency,
+			OccurredAt: balance.CheckedAt,
+		})
+	}
+}
+
+// lastTwilioBalance returns the most recent balance check, if any has succeeded
+func lastTwilioBalance() (twilioBalance, bool) {
+	latestBalanceMu.Lock()
+	defer latestBalanceMu.Unlock()
+
+	if latestBalance == nil {
+		return twilioBalance{}, false
+	}
+	return *latestBalance, true
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// blockedPattern is one entry of the content blocklist
+type blockedPattern struct {
+	term string
+	re   *regexp.Regexp
+}
+
+var contentBlocklist []blockedPattern
+
+// loadContentBlocklist reads the file named by CONTENT_BLOCKLIST. Each non-empty line is either
+// a word matched case-insensitively on word boundaries, or a regular expression prefixed with "re:".
+// Lines starting with # are comments.
+func loadContentBlocklist() {
+	path := os.Getenv("CONTENT_BLOCKLIST")
+	if path == "" {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to open content blocklist %s: %v", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var pattern string
+		if expr, ok := strings.CutPrefix(line, "re:"); ok {
+			pattern = "(?i)" + expr
+		} else {
+			pattern = `(?i)\b` + regexp.QuoteMeta(line) + `\b`
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Fatalf("Invalid content blocklist pattern on line %d of %s: %v", lineNo, path, err)
+		}
+		contentBlocklist = append(contentBlocklist, blockedPattern{term: line, re: re})
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Failed to read content blocklist %s: %v", path, err)
+	}
+
+	log.Printf("Loaded %d content blocklist patterns", len(contentBlocklist))
+}
+
+// findBlockedTerm returns the first blocklist entry matching content, if any
+func findBlockedTerm(content string) (string, bool) {
+	for _, pattern := range contentBlocklist {
+		if pattern.re.MatchString(content) {
+			return pattern.term, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// circuitBreaker stops sends after repeated transient Twilio failures. Once open it rejects
+// sends for the cooldown period, then lets a single probe through (half-open): success closes
+// the circuit again, failure re-opens it for another cooldown.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	threshold int // consecutive failures that open the circuit; 0 disables the breaker
+	cooldown  time.Duration
+}
+
+var twilioBreaker *circuitBreaker
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{state: breakerClosed, threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports whether a send may be attempted now
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		log.Println("Twilio circuit half-open, probing with one send")
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// RecordSuccess notes that Twilio handled a request, closing the circuit
+func (b *circuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != breakerClosed {
+		log.Println("Twilio circuit closed")
+	}
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// RecordFailure notes a transient Twilio failure, opening the circuit past the threshold
+func (b *circuitBreaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.failures++
+	b.probing = false
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		if b.state != breakerOpen {
+			log.Printf("Twilio circuit open after %d consecutive failures; pausing sends for %s", b.failures, b.cooldown)
+		}
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// State returns closed, open or half_open
+func (b *circuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
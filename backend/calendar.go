@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxCalendarDays = 92
+
+// calendarMessage is the summary of a message shown on a calendar day
+type calendarMessage struct {
+	ID          uint      `json:"id"`
+	PhoneNumber string    `json:"phone_number"`
+	Status      string    `json:"status"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	LocalTime   string    `json:"local_time"` // HH:MM in the requested timezone
+	Segments    int       `json:"segments"`
+}
+
+// calendarDay holds the messages scheduled on one local calendar day
+type calendarDay struct {
+	Date     string            `json:"date"` // YYYY-MM-DD in the requested timezone
+	Count    int               `json:"count"`
+	Messages []calendarMessage `json:"messages"`
+}
+
+// getMessageCalendar groups messages scheduled between from and to by day in the requested
+// timezone (default UTC). from and to are RFC3339 times or plain dates in that timezone,
+// to being exclusive; every day of the range is listed, including empty ones.
+func getMessageCalendar(c *gin.Context) {
+	loc, err := time.LoadLocation(c.DefaultQuery("timezone", "UTC"))
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, "Unknown timezone")
+		return
+	}
+
+	from, fromOK := parseCalendarBound(c.Query("from"), loc)
+	to, toOK := parseCalendarBound(c.Query("to"), loc)
+	if !fromOK || !toOK {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidDate, "from and to are required, as ISO 8601 times or YYYY-MM-DD dates")
+		return
+	}
+	if !from.Before(to) {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidDateRange, "from must be before to")
+		return
+	}
+	if to.Sub(from) > maxCalendarDays*24*time.Hour {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidDateRange, "Calendar range cannot exceed 92 days")
+		return
+	}
+
+	query := db.Scopes(forTenant(c)).Where("scheduled_at >= ? AND scheduled_at < ?", from.UTC(), to.UTC())
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var messages []Message
+	if err := query.Order("scheduled_at ASC").Find(&messages).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to fetch messages")
+		return
+	}
+
+	// Walk the local days with AddDate so days stay aligned across DST changes
+	days := []calendarDay{}
+	index := make(map[string]int)
+	start := from.In(loc)
+	for day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc); day.Before(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		index[date] = len(days)
+		days = append(days, calendarDay{Date: date, Messages: []calendarMessage{}})
+	}
+
+	for _, message := range messages {
+		local := message.ScheduledAt.In(loc)
+		i, ok := index[local.Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		days[i].Count++
+		days[i].Messages = append(days[i].Messages, calendarMessage{
+			ID:          message.ID,
+			PhoneNumber: message.PhoneNumber,
+			Status:      message.Status,
+			ScheduledAt: message.ScheduledAt,
+			LocalTime:   local.Format("15:04"),
+			Segments:    message.Segments,
+		})
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"from":     from.UTC(),
+		"to":       to.UTC(),
+		"timezone": loc.String(),
+		"total":    len(messages),
+		"days":     days,
+	})
+}
+
+// parseCalendarBound reads an RFC3339 time, or a date taken as midnight in loc
+func parseCalendarBound(value string, loc *time.Location) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Campaign groups messages that are scheduled and tracked together
+type Campaign struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	TenantID  string    `json:"-" gorm:"not null;default:'';index"`
+	Name      string    `json:"name" gorm:"not null"`
+	Status    string    `json:"status" gorm:"default:'active'"` // active, cancelled
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CreateCampaignRequest represents the request body for creating a campaign
+type CreateCampaignRequest struct {
+	Name     string                   `json:"name" binding:"required"`
+	Messages []ScheduleMessageRequest `json:"messages" binding:"required,min=1,dive"`
+	Dedupe   bool                     `json:"dedupe"`  // drop rows repeating an earlier row's number, content and time
+	Stagger  string                   `json:"stagger"` // optional duration added cumulatively to each row's send time
+}
+
+// parseStagger reads an optional non-negative stagger duration such as "2s"
+func parseStagger(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	stagger, err := time.ParseDuration(value)
+	if err != nil || stagger < 0 {
+		return 0, errors.New("Invalid stagger. Use a non-negative duration such as 2s.")
+	}
+	return stagger, nil
+}
+
+// applyStagger spreads a batch out by delaying the nth message n*stagger past its own send time,
+// so rows sharing a scheduled_at go out gradually instead of in one burst
+func applyStagger(messages []Message, stagger time.Duration) {
+	for i := range messages {
+		messages[i].ScheduledAt = messages[i].ScheduledAt.Add(time.Duration(i) * stagger)
+	}
+}
+
+// dedupeKey identifies messages that are exact duplicates within a batch
+func dedupeKey(message Message) string {
+	return message.PhoneNumber + "\x00" + message.Content + "\x00" + message.ScheduledAt.UTC().Format(time.RFC3339Nano)
+}
+
+func createCampaign(c *gin.Context) {
+	var req CreateCampaignRequest
+	if !bindScheduleJSON(c, &req) {
+		return
+	}
+
+	stagger, err := parseStagger(req.Stagger)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidDuration, err.Error())
+		return
+	}
+
+	messages := make([]Message, 0, len(req.Messages))
+	seen := make(map[string]bool)
+	duplicates := 0
+	for i, item := range req.Messages {
+		scheduledAt, apiErr := validateScheduleRequest(&item)
+		if apiErr == nil && item.Recurrence != "" {
+			apiErr = &apiError{Code: codeInvalidParameter, Message: "Campaign messages cannot recur"}
+		}
+		if apiErr == nil && item.Draft {
+			apiErr = &apiError{Code: codeInvalidParameter, Message: "Campaign messages cannot be drafts"}
+		}
+		if apiErr == nil && item.DedupeKey != "" {
+			apiErr = &apiError{Code: codeInvalidParameter, Message: "Campaign messages cannot use dedupe_key; use the campaign's dedupe option"}
+		}
+		if apiErr != nil {
+			if apiErr.Details == nil {
+				apiErr.Details = gin.H{}
+			}
+			apiErr.Details["index"] = i
+			respondAPIError(c, http.StatusBadRequest, apiErr)
+			return
+		}
+		message := newMessage(c, item, scheduledAt)
+		if apiErr := attachConsent(&message); apiErr != nil {
+			if apiErr.Details == nil {
+				apiErr.Details = gin.H{}
+			}
+			apiErr.Details["index"] = i
+			respondAPIError(c, consentErrorStatus(apiErr), apiErr)
+			return
+		}
+		if req.Dedupe {
+			key := dedupeKey(message)
+			if seen[key] {
+				duplicates++
+				continue
+			}
+			seen[key] = true
+		}
+		messages = append(messages, message)
+	}
+
+	applyStagger(messages, stagger)
+
+	if !checkBackpressure(c, len(messages)) {
+		return
+	}
+
+	campaign := Campaign{
+		TenantID:  tenantID(c),
+		Name:      req.Name,
+		Status:    "active",
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&campaign).Error; err != nil {
+			return err
+		}
+		for i := range messages {
+			messages[i].CampaignID = &campaign.ID
+		}
+		return tx.Create(&messages).Error
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create campaign")
+		return
+	}
+
+	respond(c, http.StatusCreated, gin.H{
+		"campaign":           campaign,
+		"message_count":      len(messages),
+		"duplicates_dropped": duplicates,
+	})
+}
+
+// findCampaign loads the campaign named by the :id path parameter, writing an error response on failure
+func findCampaign(c *gin.Context) (Campaign, bool) {
+	var campaign Campaign
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidCampaignID, "Invalid campaign ID")
+		return campaign, false
+	}
+
+	if err := db.Scopes(forTenant(c)).First(&campaign, uint(id)).Error; err != nil {
+		respondErrorCode(c, http.StatusNotFound, codeCampaignNotFound, "Campaign not found")
+		return campaign, false
+	}
+	return campaign, true
+}
+
+// getCampaign returns a campaign with message counts per status and overall progress
+func getCampaign(c *gin.Context) {
+	campaign, ok := findCampaign(c)
+	if !ok {
+		return
+	}
+
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	err := db.Model(&Message{}).
+		Select("status, COUNT(*) AS count").
+		Where("campaign_id = ?", campaign.ID).
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to fetch campaign")
+		return
+	}
+
+	counts := map[string]int64{"pending": 0, "sent": 0, "failed": 0, "delivered": 0}
+	var total int64
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+		total += row.Count
+	}
+
+	progress := 0.0
+	if total > 0 {
+		progress = float64(total-counts["pending"]) / float64(total) * 100
+	}
+
+	cost, err := costRollup(db.Where("campaign_id = ?", campaign.ID))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to fetch campaign")
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"campaign": campaign,
+		"total":    total,
+		"counts":   counts,
+		"progress": progress,
+		"cost":     cost,
+	})
+}
+
+// cancelCampaign cancels the campaign and every message in it that has not been sent yet
+func cancelCampaign(c *gin.Context) {
+	campaign, ok := findCampaign(c)
+	if !ok {
+		return
+	}
+
+	var cancelled int64
+	var queued []Message
+	now := time.Now().UTC()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id, campaign_id, phone_number, status").Where("campaign_id = ? AND status IN ?", campaign.ID, queuedStatuses).Find(&queued).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&Message{}).
+			Where("campaign_id = ? AND status IN ?", campaign.ID, queuedStatuses).
+			Updates(map[string]interface{}{"status": "cancelled", "status_updated_at": now, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		cancelled = result.RowsAffected
+
+		// Kept for the progress history; one transaction, so the rows match what was cancelled
+		if err := recordStatusChanges(tx, queued, "cancelled", now); err != nil {
+			return err
+		}
+
+		campaign.Status = "cancelled"
+		campaign.UpdatedAt = time.Now().UTC()
+		return tx.Save(&campaign).Error
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to cancel campaign")
+		return
+	}
+	publishStatusEvents(queued, "cancelled", now)
+
+	respond(c, http.StatusOK, gin.H{
+		"campaign":           campaign,
+		"cancelled_messages": cancelled,
+	})
+}
+
+// ShiftCampaignRequest moves a campaign's pending messages by a fixed offset
+type ShiftCampaignRequest struct {
+	Offset string `json:"offset" binding:"required"` // duration such as 2h or -30m, or days such as 1d
+}
+
+// shiftCampaign adds the offset to every pending message of the campaign in one transaction.
+// Nothing moves unless every shifted time is in the future and within the schedule horizon.
+func shiftCampaign(c *gin.Context) {
+	campaign, ok := findCampaign(c)
+	if !ok {
+		return
+	}
+	if campaign.Status == "cancelled" {
+		respondErrorCode(c, http.StatusConflict, codeCampaignCancelled, "Campaign is cancelled")
+		return
+	}
+
+	var req ShiftCampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+		return
+	}
+	offset, ok := parseOffset(req.Offset)
+	if !ok || offset == 0 {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidDuration, "offset must be a non-zero duration such as 2h, or whole days such as 1d")
+		return
+	}
+
+	var shifted int
+	var shiftErr *apiError
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var messages []Message
+		if err := tx.Where("campaign_id = ? AND status IN ?", campaign.ID, queuedStatuses).Find(&messages).Error; err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		for _, message := range messages {
+			scheduledAt := message.ScheduledAt.Add(offset).UTC()
+			if scheduledAt.Before(now) {
+				shiftErr = &apiError{
+					Code:    codeScheduledInPast,
+					Message: "Shifted time would be in the past",
+					Details: gin.H{"message_id": message.ID, "scheduled_at": scheduledAt},
+				}
+				return errShiftRejected
+			}
+			if apiErr := checkScheduleHorizon(scheduledAt); apiErr != nil {
+				apiErr.Details["message_id"] = message.ID
+				shiftErr = apiErr
+				return errShiftRejected
+			}
+
+			updates := map[string]interface{}{"scheduled_at": scheduledAt, "updated_at": now}
+			if message.NextAttemptAt != nil {
+				updates["next_attempt_at"] = message.NextAttemptAt.Add(offset).UTC()
+			}
+			// Guard on status so a message the processor picked up meanwhile is left alone
+			result := tx.Model(&Message{}).Where("id = ? AND status = ?", message.ID, message.Status).Updates(updates)
+			if result.Error != nil {
+				return result.Error
+			}
+			shifted += int(result.RowsAffected)
+		}
+		return nil
+	})
+	if shiftErr != nil {
+		respondAPIError(c, http.StatusBadRequest, shiftErr)
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to shift campaign")
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"campaign":         campaign,
+		"offset":           offset.String(),
+		"shifted_messages": shifted,
+	})
+}
+
+// errShiftRejected rolls back a shift whose results failed validation
+var errShiftRejected = errors.New("shift rejected")
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/twilio/twilio-go"
+	api "github.com/twilio/twilio-go/rest/api/v2010"
+)
+
+// stuckTimeout is how long a message may stay claimed as processing before it is presumed
+// abandoned by a crashed instance, from STUCK_TIMEOUT
+var stuckTimeout time.Duration
+
+// claimMessage moves a due message from pending to processing, so no other instance or API call
+// acts on it while it is being sent. It reports false when the message is no longer pending.
+// A claimed message is reloaded, so an edit made after the batch was loaded is what gets sent
+// and is not overwritten when the processed message is saved.
+func claimMessage(message *Message) bool {
+	now := time.Now().UTC()
+	result := db.Model(&Message{}).
+		Where("id = ? AND status = ?", message.ID, "pending").
+		UpdateColumns(map[string]interface{}{"status": "processing", "claimed_at": now})
+	if result.Error != nil {
+		log.Printf("Failed to claim message %d: %v", message.ID, result.Error)
+		return false
+	}
+	if result.RowsAffected != 1 {
+		return false
+	}
+	if err := db.First(message, message.ID).Error; err != nil {
+		log.Printf("Failed to reload claimed message %d: %v", message.ID, err)
+		releaseClaim(message)
+		return false
+	}
+	return true
+}
+
+// releaseClaim hands a claimed message back to pending without an attempt being made
+func releaseClaim(message *Message) {
+	err := withDBRetry(func() error {
+		return db.Model(&Message{}).
+			Where("id = ? AND status = ?", message.ID, "processing").
+			UpdateColumns(map[string]interface{}{"status": "pending", "claimed_at": nil}).Error
+	})
+	if err != nil {
+		log.Printf("Failed to release claim on message %d: %v", message.ID, err)
+	}
+}
+
+// reconcileSkew allows for clock drift between this host and Twilio when matching a claimed
+// message to the Twilio messages created after its claim
+const reconcileSkew = time.Minute
+
+// stuckRecovery is the outcome of one sweep over messages stuck in processing
+type stuckRecovery struct {
+	Requeued   []uint `json:"requeued"`   // never reached Twilio; pending again
+	Reconciled []uint `json:"reconciled"` // Twilio had accepted them; marked sent without resending
+	Unverified []uint `json:"unverified"` // Twilio could not be asked; left in processing for the next sweep
+}
+
+// recoverStuckMessages sweeps messages whose processing claim (their lease) is older than timeout,
+// left behind by an instance that crashed mid-send. Sends follow pending -> processing -> SID saved
+// -> sent, so a stuck message either has its SID and is finished by the processor, or is checked
+// against Twilio: one Twilio accepted before its SID was saved is marked sent with that SID, and
+// only one Twilio never saw is put back to pending. When Twilio cannot be reached the message stays
+// claimed rather than risk a second send.
+func recoverStuckMessages(timeout time.Duration) (stuckRecovery, error) {
+	recovery := stuckRecovery{Requeued: []uint{}, Reconciled: []uint{}, Unverified: []uint{}}
+	var stuck []Message
+	cutoff := time.Now().UTC().Add(-timeout)
+	if err := db.Where("status = ? AND claimed_at < ?", "processing", cutoff).Find(&stuck).Error; err != nil {
+		return recovery, err
+	}
+
+	for _, message := range stuck {
+		if message.TwilioSID == "" && !dryRun {
+			sid, via, err := findAcceptedSend(message)
+			if err != nil {
+				log.Printf("ALERT: cannot tell whether stuck message %d reached Twilio, leaving it claimed: %v", message.ID, err)
+				recovery.Unverified = append(recovery.Unverified, message.ID)
+				continue
+			}
+			if sid != "" {
+				reconciled, err := markReconciledSent(message, sid, via, cutoff)
+				if err != nil {
+					return recovery, err
+				}
+				if reconciled {
+					recovery.Reconciled = append(recovery.Reconciled, message.ID)
+				}
+				continue
+			}
+		}
+
+		result := db.Model(&Message{}).
+			Where("id = ? AND status = ? AND claimed_at < ?", message.ID, "processing", cutoff).
+			Updates(map[string]interface{}{"status": "pending", "claimed_at": nil, "updated_at": time.Now().UTC()})
+		if result.Error != nil {
+			return recovery, result.Error
+		}
+		if result.RowsAffected == 1 {
+			recovery.Requeued = append(recovery.Requeued, message.ID)
+		}
+	}
+	if len(stuck) > 0 {
+		log.Printf("Recovered messages stuck in processing: requeued %v, reconciled as sent %v, unverified %v",
+			recovery.Requeued, recovery.Reconciled, recovery.Unverified)
+	}
+	return recovery, nil
+}
+
+// findAcceptedSend asks Twilio for a message to the same recipient created since the claim that
+// no other message has recorded, returning its SID and the account of its send chain that has
+// it, or "" when none does
+func findAcceptedSend(message Message) (string, string, error) {
+	for _, account := range sendChain(message) {
+		_, restClient, err := accountNamed(account)
+		if err != nil {
+			return "", "", err
+		}
+		sid, err := findAcceptedSendOn(message, restClient)
+		if err != nil || sid != "" {
+			return sid, account, err
+		}
+	}
+	return "", "", nil
+}
+
+func findAcceptedSendOn(message Message, restClient *twilio.RestClient) (string, error) {
+	params := &api.ListMessageParams{}
+	params.SetTo(message.PhoneNumber)
+	params.SetPageSize(20)
+	params.SetLimit(20)
+	candidates, err := restClient.Api.ListMessage(params)
+	if err != nil {
+		return "", err
+	}
+
+	since := message.ClaimedAt.Add(-reconcileSkew)
+	for _, candidate := range candidates {
+		if candidate.Sid == nil || candidate.DateCreated == nil {
+			continue
+		}
+		if candidate.Direction != nil && !strings.HasPrefix(*candidate.Direction, "outbound") {
+			continue
+		}
+		created, err := time.Parse(time.RFC1123Z, *candidate.DateCreated)
+		if err != nil || created.Before(since) {
+			continue
+		}
+		var known int64
+		if err := db.Model(&Message{}).Where("twilio_sid = ?", *candidate.Sid).Count(&known).Error; err != nil {
+			return "", err
+		}
+		if known == 0 {
+			return *candidate.Sid, nil
+		}
+	}
+	return "", nil
+}
+
+// markReconciledSent records a stuck message as sent under the SID Twilio reported for it
+func markReconciledSent(message Message, sid, via string, cutoff time.Time) (bool, error) {
+	now := time.Now().UTC()
+	result := db.Model(&Message{}).
+		Where("id = ? AND status = ? AND claimed_at < ?", message.ID, "processing", cutoff).
+		Updates(map[string]interface{}{
+			"status":            "sent",
+			"twilio_sid":        sid,
+			"sent_via":          via,
+			"sent_at":           now,
+			"claimed_at":        nil,
+			"last_error":        "",
+			"status_updated_at": now,
+			"updated_at":        now,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+
+	log.Printf("Stuck message %d had been accepted by Twilio as %s; marked sent without resending", message.ID, sid)
+	message.Status = "sent"
+	message.TwilioSID = sid
+	message.SentAt = &now
+	message.StatusUpdatedAt = &now
+	publishStatusChange(message, "processing")
+	return true, nil
+}
+
+// recoverStuck runs the stuck-message sweep on demand
+func recoverStuck(c *gin.Context) {
+	recovery, err := recoverStuckMessages(stuckTimeout)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to recover stuck messages")
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"recovered":     len(recovery.Requeued) + len(recovery.Reconciled),
+		"requeued":      recovery.Requeued,
+		"reconciled":    recovery.Reconciled,
+		"unverified":    recovery.Unverified,
+		"stuck_timeout": stuckTimeout.String(),
+	})
+}
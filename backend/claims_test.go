@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClaimMessageSendsEditMadeAfterBatchLoad(t *testing.T) {
+	useTestDB(t)
+	now := time.Now().UTC()
+	message := Message{PhoneNumber: "+15551230001", Content: "original", Status: "pending", ScheduledAt: now, CreatedAt: now, UpdatedAt: now}
+	if err := db.Create(&message).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The processor loads its batch, then the message is edited before it is claimed
+	var batch []Message
+	if err := db.Where("status = ? AND scheduled_at <= ?", "pending", now).Find(&batch).Error; err != nil || len(batch) != 1 {
+		t.Fatalf("batch = %v, %v", batch, err)
+	}
+	edit := map[string]interface{}{"content": "edited", "phone_number": "+15551230002", "updated_at": time.Now().UTC()}
+	if err := db.Model(&Message{}).Where("id = ?", message.ID).Updates(edit).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	claimed := batch[0]
+	if !claimMessage(&claimed) {
+		t.Fatal("claimMessage refused a pending message")
+	}
+	if claimed.Content != "edited" || claimed.PhoneNumber != "+15551230002" {
+		t.Errorf("claimed message = %q to %s, want the edit", claimed.Content, claimed.PhoneNumber)
+	}
+	if claimed.Status != "processing" || claimed.ClaimedAt == nil {
+		t.Errorf("claimed message status = %s, claimed_at = %v", claimed.Status, claimed.ClaimedAt)
+	}
+
+	// Saving the processed message must keep the edit
+	claimed.Status = "sent"
+	saveProcessedMessage(&claimed, "pending")
+	var stored Message
+	if err := db.First(&stored, message.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Content != "edited" || stored.PhoneNumber != "+15551230002" {
+		t.Errorf("stored message = %q to %s, want the edit", stored.Content, stored.PhoneNumber)
+	}
+}
+
+func TestClaimMessageSkipsMessageNoLongerPending(t *testing.T) {
+	useTestDB(t)
+	now := time.Now().UTC()
+	message := Message{PhoneNumber: "+15551230001", Content: "hi", Status: "pending", ScheduledAt: now, CreatedAt: now, UpdatedAt: now}
+	if err := db.Create(&message).Error; err != nil {
+		t.Fatal(err)
+	}
+	loaded := message
+	if err := db.Model(&Message{}).Where("id = ?", message.ID).Update("status", "cancelled").Error; err != nil {
+		t.Fatal(err)
+	}
+	if claimMessage(&loaded) {
+		t.Error("claimMessage claimed a cancelled message")
+	}
+}
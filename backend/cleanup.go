@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// registerCleanupJob schedules the deletion of terminal messages last updated more than
+// RETENTION_DAYS ago, on CLEANUP_CRON. Retention 0, the default, keeps messages forever.
+func registerCleanupJob() {
+	retentionDays := getEnvInt("RETENTION_DAYS", 0)
+	if retentionDays <= 0 {
+		return
+	}
+
+	spec := getEnvString("CLEANUP_CRON", "30 3 * * *")
+	err := registerSystemJob("cleanup", spec, func() { cleanupMessages(retentionDays) })
+	if err != nil {
+		log.Fatalf("Invalid CLEANUP_CRON %q: %v", spec, err)
+	}
+}
+
+func cleanupMessages(retentionDays int) {
+	cutoff := time.Now().UTC().AddDate(0, 0, -retentionDays)
+	result := db.Where("status IN ? AND updated_at < ?", terminalStatuses, cutoff).Delete(&Message{})
+	if result.Error != nil {
+		log.Printf("Cleanup of messages older than %s failed: %v", cutoff.Format(time.RFC3339), result.Error)
+		return
+	}
+	log.Printf("Cleanup removed %d messages older than %s", result.RowsAffected, cutoff.Format(time.RFC3339))
+
+	if err := db.Where("expires_at < ?", time.Now().UTC()).Delete(&DedupeKey{}).Error; err != nil {
+		log.Printf("Cleanup of expired dedupe keys failed: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// getEnvString reads an environment variable, falling back when unset
+func getEnvString(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt reads an integer environment variable, falling back when unset or invalid
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using default %d", value, key, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvDuration reads a time.ParseDuration-style environment variable, falling back when unset or invalid
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using default %s", value, key, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvFloat reads a floating point environment variable, falling back when unset or invalid
+func getEnvFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using default %g", value, key, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvBool reads a strconv.ParseBool-style environment variable, falling back when unset or invalid
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using default %t", value, key, fallback)
+		return fallback
+	}
+	return parsed
+}
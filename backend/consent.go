@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Consent records that a recipient opted in to messages of a category, and how
+type Consent struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	TenantID    string     `json:"-" gorm:"not null;default:'';index:idx_consent_recipient"`
+	PhoneNumber string     `json:"phone_number" gorm:"not null;index:idx_consent_recipient"`
+	Category    string     `json:"category"`  // empty is general consent, covering every category
+	Method      string     `json:"method"`    // how consent was given, e.g. web_form, keyword, paper
+	Reference   string     `json:"reference"` // proof, e.g. a form submission ID or signed document
+	ConsentedAt time.Time  `json:"consented_at" gorm:"not null"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// ConsentRequest records one recipient's opt-in
+type ConsentRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required"`
+	Category    string `json:"category"`
+	Method      string `json:"method" binding:"required"`
+	Reference   string `json:"reference"`
+	ConsentedAt string `json:"consented_at"` // ISO format; defaults to now
+}
+
+// consentRequired lists the message categories that need recorded consent, from CONSENT_REQUIRED.
+// "*" requires it for every message, uncategorized ones included.
+var consentRequired map[string]bool
+
+func loadConsentConfig() {
+	consentRequired = make(map[string]bool)
+	for _, category := range strings.Split(os.Getenv("CONSENT_REQUIRED"), ",") {
+		if category = strings.TrimSpace(category); category != "" {
+			consentRequired[category] = true
+		}
+	}
+}
+
+// attachConsent finds the recipient's live consent for the message's category and stores its ID
+// on the message. Without one the message is rejected when its category requires consent. It is
+// called again whenever the recipient changes or the message becomes pending.
+func attachConsent(message *Message) *apiError {
+	message.ConsentID = nil
+	var consent Consent
+	err := db.Where("tenant_id = ?", message.TenantID).
+		Where("phone_number = ? AND category IN ? AND revoked_at IS NULL", message.PhoneNumber, []string{message.Category, ""}).
+		Order("consented_at DESC").
+		Limit(1).
+		Find(&consent).Error
+	if err != nil {
+		return &apiError{Message: "Failed to look up consent: " + err.Error()}
+	}
+	if consent.ID != 0 {
+		message.ConsentID = &consent.ID
+		return nil
+	}
+	if consentRequired["*"] || (message.Category != "" && consentRequired[message.Category]) {
+		return &apiError{
+			Code:    codeConsentMissing,
+			Message: "Recipient has no recorded consent for this category",
+			Details: gin.H{"phone_number": message.PhoneNumber, "category": message.Category},
+		}
+	}
+	return nil
+}
+
+// consentErrorStatus is the HTTP status of an attachConsent error: a lookup failure is ours
+func consentErrorStatus(apiErr *apiError) int {
+	if apiErr.Code == codeConsentMissing {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+func recordConsent(c *gin.Context) {
+	var req ConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+		return
+	}
+	phone, err := normalizePhoneNumber(req.PhoneNumber)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidPhoneNumber, err.Error())
+		return
+	}
+
+	consentedAt := time.Now().UTC()
+	if req.ConsentedAt != "" {
+		parsed, apiErr := parseSendTime(req.ConsentedAt, "")
+		if apiErr != nil {
+			respondAPIError(c, http.StatusBadRequest, apiErr)
+			return
+		}
+		if parsed.After(consentedAt) {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidDate, "consented_at cannot be in the future")
+			return
+		}
+		consentedAt = parsed
+	}
+
+	consent := Consent{
+		TenantID:    tenantID(c),
+		PhoneNumber: phone,
+		Category:    req.Category,
+		Method:      req.Method,
+		Reference:   req.Reference,
+		ConsentedAt: consentedAt,
+	}
+	if err := db.Create(&consent).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to record consent")
+		return
+	}
+
+	respond(c, http.StatusCreated, consent)
+}
+
+// getRecipientConsent lists every consent recorded for a phone number, revoked ones included
+func getRecipientConsent(c *gin.Context) {
+	phone, err := normalizePhoneNumber(c.Param("phone"))
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidPhoneNumber, err.Error())
+		return
+	}
+
+	var consents []Consent
+	if err := db.Scopes(forTenant(c)).Where("phone_number = ?", phone).Order("consented_at DESC").Find(&consents).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to fetch consent")
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{"phone_number": phone, "consents": consents})
+}
+
+// revokeConsent marks a consent revoked; it is kept as a record of the earlier opt-in
+func revokeConsent(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, "Invalid consent ID")
+		return
+	}
+
+	now := time.Now().UTC()
+	result := db.Scopes(forTenant(c)).Model(&Consent{}).
+		Where("id = ? AND revoked_at IS NULL", uint(id)).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to revoke consent")
+		return
+	}
+	if result.RowsAffected == 0 {
+		respondErrorCode(c, http.StatusNotFound, codeConsentNotFound, "Consent not found or already revoked")
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{"id": uint(id), "revoked_at": now})
+}
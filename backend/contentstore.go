@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// contentStore keeps large message bodies outside the messages table, addressed by key
+type contentStore interface {
+	Put(body string) (string, error)
+	Get(key string) (string, error)
+}
+
+// externalContent is where bodies longer than contentStoreThreshold bytes go;
+// nil (CONTENT_STORE=db) keeps every body inline
+var externalContent contentStore
+var contentStoreThreshold int
+
+// loadContentStore configures the store selected by CONTENT_STORE
+func loadContentStore() {
+	contentStoreThreshold = getEnvInt("CONTENT_STORE_THRESHOLD", 1600)
+
+	switch kind := getEnvString("CONTENT_STORE", "db"); kind {
+	case "db":
+	case "file":
+		dir := getEnvString("CONTENT_STORE_DIR", "content")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Fatalf("Failed to create content store directory %s: %v", dir, err)
+		}
+		externalContent = fileContentStore{dir: dir}
+	case "s3":
+		bucket, err := loadS3Bucket("CONTENT")
+		if err != nil {
+			log.Fatal("Invalid S3 content store configuration: ", err)
+		}
+		externalContent = s3ContentStore{bucket}
+	default:
+		log.Fatalf("Unknown CONTENT_STORE %q; use db, file or s3", kind)
+	}
+}
+
+// fileContentStore writes each body to a file named after its SHA-256, so identical
+// bodies (e.g. a campaign's) share one file and files never need rewriting
+type fileContentStore struct {
+	dir string
+}
+
+func (s fileContentStore) Put(body string) (string, error) {
+	sum := sha256.Sum256([]byte(body))
+	key := hex.EncodeToString(sum[:])
+
+	path := filepath.Join(s.dir, key)
+	if _, err := os.Stat(path); err == nil {
+		return key, nil
+	}
+	// Write then rename so a concurrent reader never sees a partial body
+	tmp, err := os.CreateTemp(s.dir, key+".tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.WriteString(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return key, os.Rename(tmp.Name(), path)
+}
+
+func (s fileContentStore) Get(key string) (string, error) {
+	body, err := os.ReadFile(filepath.Join(s.dir, filepath.Base(key)))
+	return string(body), err
+}
+
+// s3ContentStore keeps each body as an object named after its SHA-256, like fileContentStore,
+// in an S3 (or S3-compatible) bucket
+type s3ContentStore struct {
+	s3Bucket
+}
+
+func (s s3ContentStore) Put(body string) (string, error) {
+	sum := sha256.Sum256([]byte(body))
+	key := hex.EncodeToString(sum[:])
+	// The key is the content's hash, so writing it again is harmless
+	if _, err := s.request(http.MethodPut, key, []byte(body)); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func (s s3ContentStore) Get(key string) (string, error) {
+	body, err := s.request(http.MethodGet, key, nil)
+	return string(body), err
+}
+
+// request sends one signed request for the object under key and returns the response body
+func (s s3ContentStore) request(method, key string, body []byte) ([]byte, error) {
+	target, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s %s: unexpected status %d: %s", method, key, resp.StatusCode, bytes.TrimSpace(detail))
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// BeforeSave moves oversized bodies to the content store, leaving only their keys on the row
+func (m *Message) BeforeSave(tx *gorm.DB) error {
+	if externalContent == nil {
+		return nil
+	}
+	if err := externalize(&m.Content, &m.ContentKey, &m.inlineContent); err != nil {
+		return fmt.Errorf("store content of message %d: %w", m.ID, err)
+	}
+	if err := externalize(&m.RenderedContent, &m.RenderedContentKey, &m.inlineRenderedContent); err != nil {
+		return fmt.Errorf("store rendered content of message %d: %w", m.ID, err)
+	}
+	return nil
+}
+
+// AfterSave puts the bodies BeforeSave moved out back on the struct for the caller
+func (m *Message) AfterSave(tx *gorm.DB) error {
+	if m.ContentKey != "" {
+		m.Content = m.inlineContent
+	}
+	if m.RenderedContentKey != "" {
+		m.RenderedContent = m.inlineRenderedContent
+	}
+	return nil
+}
+
+// AfterFind loads externally stored bodies, so callers always see the full content
+func (m *Message) AfterFind(tx *gorm.DB) error {
+	var err error
+	if m.ContentKey != "" {
+		if m.Content, err = loadExternalContent(m.ContentKey); err != nil {
+			return fmt.Errorf("load content of message %d: %w", m.ID, err)
+		}
+	}
+	if m.RenderedContentKey != "" {
+		if m.RenderedContent, err = loadExternalContent(m.RenderedContentKey); err != nil {
+			return fmt.Errorf("load rendered content of message %d: %w", m.ID, err)
+		}
+	}
+	return nil
+}
+
+// externalize stores body when it is over the threshold, blanking the column and remembering
+// the body in stash; shorter bodies stay inline
+func externalize(body, key, stash *string) error {
+	if len(*body) <= contentStoreThreshold {
+		*key = ""
+		return nil
+	}
+
+	stored, err := externalContent.Put(*body)
+	if err != nil {
+		return err
+	}
+	*key = stored
+	*stash = *body
+	*body = ""
+	return nil
+}
+
+func loadExternalContent(key string) (string, error) {
+	if externalContent == nil {
+		return "", fmt.Errorf("content %s is stored externally but CONTENT_STORE is db", key)
+	}
+	return externalContent.Get(key)
+}
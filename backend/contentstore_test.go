@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestS3ContentStoreRoundTrip(t *testing.T) {
+	var mu sync.Mutex
+	objects := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, "unsigned request", http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = string(body)
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			io.WriteString(w, body)
+		}
+	}))
+	defer server.Close()
+
+	store := s3ContentStore{s3Bucket{endpoint: server.URL, bucket: "bodies", prefix: "content/", region: "us-east-1", accessKey: "AKID", secretKey: "secret"}}
+	body := strings.Repeat("a long campaign body ", 200)
+	key, err := store.Put(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objects["/bodies/content/"+key]; !ok {
+		t.Fatalf("object not stored under /bodies/content/%s: %v", key, objects)
+	}
+	got, err := store.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != body {
+		t.Errorf("Get returned %d bytes, want the %d stored", len(got), len(body))
+	}
+	if _, err := store.Get("missing"); err == nil {
+		t.Error("Get of a missing object succeeded")
+	}
+}
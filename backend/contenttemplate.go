@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contentSIDPattern matches Twilio Content API template SIDs
+var contentSIDPattern = regexp.MustCompile(`^HX[0-9a-fA-F]{32}$`)
+
+// validateContentTemplate checks that a request gives exactly one of content and content_sid,
+// or neither for a media-only MMS, and that a template send uses none of the body-only
+// features. It returns the template's variables encoded as Twilio's ContentVariables JSON.
+func validateContentTemplate(req *ScheduleMessageRequest) (string, *apiError) {
+	hasContent := req.Content != "" || len(req.Variants) > 0
+	mediaOnly := !hasContent && req.ContentSID == "" && req.MediaKey != ""
+	if hasContent == (req.ContentSID != "") && !mediaOnly {
+		return "", &apiError{Code: codeInvalidParameter, Message: "Give exactly one of content and content_sid"}
+	}
+	if req.ContentSID == "" {
+		if len(req.ContentVariables) > 0 {
+			return "", &apiError{Code: codeInvalidParameter, Message: "content_variables requires content_sid"}
+		}
+		return "", nil
+	}
+
+	if !contentSIDPattern.MatchString(req.ContentSID) {
+		return "", &apiError{Code: codeInvalidParameter, Message: "content_sid must be a Twilio Content SID such as HX...", Details: gin.H{"content_sid": req.ContentSID}}
+	}
+	if req.VariablesURL != "" || req.MediaKey != "" || req.Recurrence != "" {
+		return "", &apiError{Code: codeInvalidParameter, Message: "content_sid cannot be combined with variables_url, media_key or recurrence"}
+	}
+	if len(req.ContentVariables) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(req.ContentVariables)
+	if err != nil {
+		return "", &apiError{Code: codeInvalidParameter, Message: "content_variables must be an object of strings"}
+	}
+	return string(encoded), nil
+}
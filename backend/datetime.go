@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// offsetLayouts are the accepted send-time layouts that carry their own UTC offset, in the order tried
+var offsetLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04Z07:00",
+}
+
+// localLayouts are the accepted zone-less layouts, resolved in the request's timezone
+var localLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// parseSendTime parses a near-ISO 8601 time such as 2024-01-02T15:04 or 2024-01-02 15:04:05+02:00.
+// Times without an offset are taken in timezone, an IANA name, or the server's zone when it is empty.
+func parseSendTime(raw, timezone string) (time.Time, *apiError) {
+	for _, layout := range offsetLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	loc := time.Local
+	if timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return time.Time{}, &apiError{Code: codeInvalidParameter, Message: fmt.Sprintf("Unknown timezone %q", timezone)}
+		}
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, raw, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, &apiError{Code: codeInvalidDate, Message: "Invalid date format. Use ISO 8601 format, e.g. 2024-01-02T15:04:05Z."}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSendTimeOffsets(t *testing.T) {
+	tests := []struct {
+		raw      string
+		timezone string
+		want     time.Time
+	}{
+		{"2030-01-02T15:04:05Z", "", time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"2030-01-02T15:04:05+05:30", "", time.Date(2030, 1, 2, 9, 34, 5, 0, time.UTC)},
+		{"2030-01-02T15:04:05-08:00", "", time.Date(2030, 1, 2, 23, 4, 5, 0, time.UTC)},
+		{"2030-01-02T23:30-08:00", "", time.Date(2030, 1, 3, 7, 30, 0, 0, time.UTC)},
+		{"2030-01-02 15:04:05+05:30", "", time.Date(2030, 1, 2, 9, 34, 5, 0, time.UTC)},
+		{"2030-01-02 00:15+05:30", "", time.Date(2030, 1, 1, 18, 45, 0, 0, time.UTC)},
+		{"2030-01-02T15:04:05.250+02:00", "", time.Date(2030, 1, 2, 13, 4, 5, 250e6, time.UTC)},
+		// An explicit offset wins over the request's timezone
+		{"2030-01-02T15:04:05-08:00", "Asia/Kolkata", time.Date(2030, 1, 2, 23, 4, 5, 0, time.UTC)},
+		{"2030-01-02T15:04", "Asia/Kolkata", time.Date(2030, 1, 2, 9, 34, 0, 0, time.UTC)},
+		{"2030-07-02 15:04:05", "America/Los_Angeles", time.Date(2030, 7, 2, 22, 4, 5, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, apiErr := parseSendTime(tt.raw, tt.timezone)
+		if apiErr != nil {
+			t.Errorf("parseSendTime(%q, %q) failed: %s", tt.raw, tt.timezone, apiErr.Message)
+			continue
+		}
+		if !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("parseSendTime(%q, %q) = %v, want %v", tt.raw, tt.timezone, got, tt.want)
+		}
+	}
+}
+
+func TestParseSendTimeInvalid(t *testing.T) {
+	tests := []struct {
+		raw      string
+		timezone string
+		code     string
+	}{
+		{"2030-01-02T15:04:05+25:00", "", codeInvalidDate},
+		{"tomorrow", "", codeInvalidDate},
+		{"2030-01-02T15:04", "Mars/Olympus", codeInvalidParameter},
+	}
+	for _, tt := range tests {
+		if _, apiErr := parseSendTime(tt.raw, tt.timezone); apiErr == nil || apiErr.Code != tt.code {
+			t.Errorf("parseSendTime(%q, %q) error = %v, want code %s", tt.raw, tt.timezone, apiErr, tt.code)
+		}
+	}
+}
+
+func TestParseScheduledAtStoresUTC(t *testing.T) {
+	want := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Second)
+	for _, offset := range []string{"+05:30", "-08:00", "+00:00", "-03:30"} {
+		zone, err := time.Parse("-07:00", offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw := want.In(zone.Location()).Format(time.RFC3339)
+		got, apiErr := parseScheduledAt(raw, "")
+		if apiErr != nil {
+			t.Errorf("parseScheduledAt(%q) failed: %s", raw, apiErr.Message)
+			continue
+		}
+		if !got.Equal(want) || got.Location() != time.UTC {
+			t.Errorf("parseScheduledAt(%q) = %v, want %v", raw, got, want)
+		}
+	}
+}
+
+func TestDueQueryWithOffsetScheduledAt(t *testing.T) {
+	useTestDB(t)
+	due := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Second)
+	for _, offset := range []string{"+05:30", "-08:00"} {
+		zone, _ := time.Parse("-07:00", offset)
+		raw := due.In(zone.Location()).Format(time.RFC3339)
+		scheduledAt, apiErr := parseScheduledAt(raw, "")
+		if apiErr != nil {
+			t.Fatalf("parseScheduledAt(%q) failed: %s", raw, apiErr.Message)
+		}
+		message := Message{PhoneNumber: "+15551230001", Content: offset, Status: "pending", ScheduledAt: scheduledAt}
+		if err := db.Create(&message).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range []struct {
+			now  time.Time
+			want bool
+		}{
+			{due.Add(-time.Second), false},
+			{due, true},
+			{due.Add(time.Second), true},
+		} {
+			var found []Message
+			if err := dueMessages(tt.now).Where("id = ?", message.ID).Find(&found).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got := len(found) == 1; got != tt.want {
+				t.Errorf("message scheduled %s: due at %s = %t, want %t", raw, tt.now.Format(time.RFC3339), got, tt.want)
+			}
+		}
+		db.Delete(&message)
+	}
+}
+
+func TestNormalizeStoredTimes(t *testing.T) {
+	useTestDB(t)
+	instant := time.Date(2030, 1, 2, 9, 34, 5, 0, time.UTC)
+	local := instant.In(time.FixedZone("IST", 5*3600+1800)) // 15:04:05+05:30, which sorts after 12:00+00:00
+	message := Message{PhoneNumber: "+15551230001", Content: "hi", Status: "processing", ScheduledAt: local, CreatedAt: local, UpdatedAt: local}
+	if err := db.Create(&message).Error; err != nil {
+		t.Fatal(err)
+	}
+	columns := []string{"scheduled_at", "next_attempt_at", "sent_at", "delivered_at", "claimed_at", "status_updated_at", "reviewed_at"}
+	updates := make(map[string]interface{}, len(columns))
+	for _, column := range columns {
+		updates[column] = local
+	}
+	if err := db.Model(&Message{}).Where("id = ?", message.ID).UpdateColumns(updates).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Before normalizing, text comparison puts the offset time after a later UTC one
+	cutoff := time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC)
+	var count int64
+	db.Model(&Message{}).Where("claimed_at < ?", cutoff).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected the unnormalized claimed_at to compare wrongly; the test no longer shows the problem")
+	}
+
+	if err := normalizeStoredTimes(); err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range append(columns, "created_at", "updated_at") {
+		// Cast so the driver hands back the stored text instead of a parsed time
+		var stored string
+		if err := db.Raw("SELECT CAST("+column+" AS TEXT) FROM messages WHERE id = ?", message.ID).Scan(&stored).Error; err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := time.Parse("2006-01-02 15:04:05.999999999-07:00", stored)
+		if err != nil || !parsed.Equal(instant) || len(stored) < 6 || stored[len(stored)-6:] != "+00:00" {
+			t.Errorf("%s stored as %q, want %s in UTC", column, stored, instant)
+		}
+	}
+	// The stuck-claim sweep compares claimed_at, and now sees the message
+	if err := db.Model(&Message{}).Where("status = ? AND claimed_at < ?", "processing", cutoff).Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("claimed_at < %s matched %d messages, want 1 (%v)", cutoff, count, err)
+	}
+}
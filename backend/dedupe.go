@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DedupeKey records the message created under a client-chosen dedupe key until it expires.
+// While the key is live, scheduling again with it returns that message instead of a new one.
+type DedupeKey struct {
+	TenantID  string    `gorm:"primaryKey"`
+	Key       string    `gorm:"primaryKey"`
+	MessageID uint      `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// errDedupeHit rolls back a create whose dedupe key turned out to be live
+var errDedupeHit = errors.New("dedupe key is live")
+
+// parseDedupeTTL validates the dedupe fields of a schedule request
+func parseDedupeTTL(req *ScheduleMessageRequest) (time.Duration, *apiError) {
+	if req.DedupeKey == "" {
+		if req.DedupeTTL != "" {
+			return 0, &apiError{Code: codeInvalidParameter, Message: "dedupe_ttl requires dedupe_key"}
+		}
+		return 0, nil
+	}
+	if len(req.DedupeKey) > 255 {
+		return 0, &apiError{Code: codeInvalidParameter, Message: "dedupe_key must be at most 255 characters"}
+	}
+	ttl, ok := parseOffset(req.DedupeTTL)
+	if !ok || ttl <= 0 {
+		return 0, &apiError{Code: codeInvalidDuration, Message: "dedupe_ttl must be a positive duration such as 12h, or whole days such as 7d"}
+	}
+	return ttl, nil
+}
+
+// createDeduplicated creates the message and its dedupe key in one transaction. When a live key
+// already exists the prior message is loaded into message instead and true is returned.
+func createDeduplicated(c *gin.Context, message *Message, key string, ttl time.Duration) (bool, error) {
+	tenant := tenantID(c)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		if err := tx.Where("tenant_id = ? AND key = ? AND expires_at <= ?", tenant, key, now).Delete(&DedupeKey{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+
+		entry := DedupeKey{TenantID: tenant, Key: key, MessageID: message.ID, ExpiresAt: now.Add(ttl)}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errDedupeHit
+		}
+		return nil
+	})
+	if !errors.Is(err, errDedupeHit) {
+		return false, err
+	}
+
+	var entry DedupeKey
+	if err := db.Where("tenant_id = ? AND key = ?", tenant, key).First(&entry).Error; err != nil {
+		return false, err
+	}
+	*message = Message{}
+	if err := db.Scopes(forTenant(c)).First(message, entry.MessageID).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// respondDeduplicated answers a schedule request whose dedupe key matched an earlier message
+func respondDeduplicated(c *gin.Context, message Message) {
+	c.Header("X-Deduplicated", "true")
+	respond(c, http.StatusOK, message)
+}
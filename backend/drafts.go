@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ActivateDraftRequest gives a draft the send time it is queued for
+type ActivateDraftRequest struct {
+	ScheduledAt string `json:"scheduled_at" binding:"required"` // ISO format
+	Timezone    string `json:"timezone"`                        // IANA zone for a scheduled_at without an offset
+}
+
+// activateDraft turns a draft into a pending (or pending_approval) message scheduled for the requested time
+func activateDraft(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidMessageID, "Invalid message ID")
+		return
+	}
+
+	var req ActivateDraftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+		return
+	}
+	scheduledAt, apiErr := parseScheduledAt(req.ScheduledAt, req.Timezone)
+	if apiErr != nil {
+		respondAPIError(c, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	var message Message
+	if err := db.Scopes(forTenant(c)).First(&message, uint(id)).Error; err != nil {
+		respondErrorCode(c, http.StatusNotFound, codeMessageNotFound, "Message not found")
+		return
+	}
+	if message.Status != "draft" {
+		respondErrorCode(c, http.StatusBadRequest, codeMessageNotEditable, "Only draft messages can be activated")
+		return
+	}
+	if apiErr := attachConsent(&message); apiErr != nil {
+		respondAPIError(c, consentErrorStatus(apiErr), apiErr)
+		return
+	}
+	if !checkBackpressure(c, 1) {
+		return
+	}
+
+	now := time.Now().UTC()
+	status := queuedStatus()
+	result := db.Model(&Message{}).
+		Where("id = ? AND status = ?", message.ID, "draft").
+		Updates(map[string]interface{}{
+			"status":            status,
+			"scheduled_at":      scheduledAt,
+			"consent_id":        message.ConsentID,
+			"status_updated_at": now,
+			"updated_at":        now,
+		})
+	if result.Error != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to activate draft")
+		return
+	}
+	if result.RowsAffected == 0 {
+		respondErrorCode(c, http.StatusConflict, codeMessageNotEditable, "Message is no longer a draft")
+		return
+	}
+
+	message.Status = status
+	message.ScheduledAt = scheduledAt
+	message.StatusUpdatedAt = &now
+	message.UpdatedAt = now
+	publishStatusChange(message, "draft")
+
+	if message.Status == "pending" {
+		estimate := estimatedSendAt(message.ScheduledAt)
+		message.EstimatedSendAt = &estimate
+	}
+	respond(c, http.StatusOK, message)
+}
+
+// DuplicateMessageRequest optionally schedules the copy straight away instead of leaving a draft
+type DuplicateMessageRequest struct {
+	ScheduledAt string `json:"scheduled_at"` // ISO format; when set the copy is pending for this time
+	Timezone    string `json:"timezone"`     // IANA zone for a scheduled_at without an offset
+}
+
+// duplicateMessage copies a message's recipient, body and media settings into a new draft, or a new
+// pending message when scheduled_at is given. Delivery state (status, SID, errors) is not copied.
+func duplicateMessage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidMessageID, "Invalid message ID")
+		return
+	}
+
+	var req DuplicateMessageRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+			return
+		}
+	}
+
+	var source Message
+	if err := db.Scopes(forTenant(c)).First(&source, uint(id)).Error; err != nil {
+		respondErrorCode(c, http.StatusNotFound, codeMessageNotFound, "Message not found")
+		return
+	}
+	if term, blocked := findBlockedTerm(source.Content); blocked {
+		respondAPIError(c, http.StatusBadRequest, blockedContentError(term))
+		return
+	}
+	if apiErr := validateMediaKey(source.MediaKey); apiErr != nil {
+		respondAPIError(c, http.StatusBadRequest, apiErr)
+		return
+	}
+	if apiErr := validateAccount(source.Account); apiErr != nil {
+		respondAPIError(c, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	now := time.Now().UTC()
+	message := Message{
+		TenantID:         source.TenantID,
+		CreatedBy:        requestActor(c),
+		PhoneNumber:      source.PhoneNumber,
+		Category:         source.Category,
+		Content:          source.Content,
+		ContentSID:       source.ContentSID,
+		ContentVariables: source.ContentVariables,
+		TwilioParams:     source.TwilioParams,
+		SendWindow:       source.SendWindow,
+		SkipFooter:       source.SkipFooter,
+		VariablesURL:     source.VariablesURL,
+		Account:          source.Account,
+		MediaKey:         source.MediaKey,
+		MaxStaleness:     source.MaxStaleness,
+		Status:           "draft",
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if apiErr := attachConsent(&message); apiErr != nil {
+		respondAPIError(c, consentErrorStatus(apiErr), apiErr)
+		return
+	}
+	if req.ScheduledAt != "" {
+		scheduledAt, apiErr := parseScheduledAt(req.ScheduledAt, req.Timezone)
+		if apiErr != nil {
+			respondAPIError(c, http.StatusBadRequest, apiErr)
+			return
+		}
+		if !checkBackpressure(c, 1) {
+			return
+		}
+		message.Status = queuedStatus()
+		message.ScheduledAt = scheduledAt
+	}
+	if message.ContentSID == "" {
+		message.Segments, _ = countSegments(renderContent(message))
+	}
+
+	if err := db.Create(&message).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to duplicate message")
+		return
+	}
+
+	if message.Status == "pending" {
+		estimate := estimatedSendAt(message.ScheduledAt)
+		message.EstimatedSendAt = &estimate
+	}
+	respond(c, http.StatusCreated, message)
+}
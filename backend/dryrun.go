@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dryRun makes sendMessage record sends in sent_log instead of calling Twilio, from DRY_RUN
+var dryRun bool
+
+// SentLog is the record of a message "sent" while DRY_RUN is on; real sends never write here
+type SentLog struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	TenantID    string    `json:"-" gorm:"not null;default:'';index"`
+	MessageID   uint      `json:"message_id" gorm:"index"` // 0 for test sends, which are not stored
+	PhoneNumber string    `json:"phone_number" gorm:"not null"`
+	Body        string    `json:"body" gorm:"not null"`
+	SentAt      time.Time `json:"sent_at" gorm:"not null"`
+}
+
+func (SentLog) TableName() string {
+	return "sent_log"
+}
+
+// recordDryRunSend stands in for the Twilio call while DRY_RUN is on
+func recordDryRunSend(message *Message) error {
+	entry := SentLog{
+		TenantID:    message.TenantID,
+		MessageID:   message.ID,
+		PhoneNumber: message.PhoneNumber,
+		Body:        message.RenderedContent,
+		SentAt:      time.Now().UTC(),
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		return err
+	}
+	message.DryRun = true
+	log.Printf("Dry run: recorded message %d to %s in sent_log (entry %d)", message.ID, message.PhoneNumber, entry.ID)
+	return nil
+}
+
+// getSentLog lists dry-run sends, newest first, optionally for one message_id
+func getSentLog(c *gin.Context) {
+	query := db.Scopes(forTenant(c))
+	if messageID := c.Query("message_id"); messageID != "" {
+		query = query.Where("message_id = ?", messageID)
+	}
+
+	var entries []SentLog
+	if err := query.Order("id DESC").Find(&entries).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to fetch sent log")
+		return
+	}
+
+	respond(c, http.StatusOK, entries)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Group is a named distribution list; scheduling to it creates one message per member
+type Group struct {
+	ID          uint          `json:"id" gorm:"primaryKey"`
+	TenantID    string        `json:"-" gorm:"not null;default:'';index"`
+	Name        string        `json:"name" gorm:"not null"`
+	Members     []GroupMember `json:"members,omitempty"`
+	MemberCount int64         `json:"member_count" gorm:"-"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// GroupMember is one recipient of a group
+type GroupMember struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	GroupID     uint      `json:"-" gorm:"not null;uniqueIndex:idx_group_member"`
+	PhoneNumber string    `json:"phone_number" gorm:"not null;uniqueIndex:idx_group_member"`
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// GroupRequest creates a group or replaces its name and members
+type GroupRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Members []struct {
+		PhoneNumber string `json:"phone_number" binding:"required"`
+		Name        string `json:"name"`
+	} `json:"members"`
+}
+
+// groupMembers validates a group request's members, normalizing numbers and dropping repeats
+func groupMembers(req GroupRequest) ([]GroupMember, *apiError) {
+	members := make([]GroupMember, 0, len(req.Members))
+	seen := make(map[string]bool)
+	for i, member := range req.Members {
+		phone, err := normalizePhoneNumber(member.PhoneNumber)
+		if err != nil {
+			return nil, &apiError{Code: codeInvalidPhoneNumber, Message: err.Error(), Details: gin.H{"index": i}}
+		}
+		if seen[phone] {
+			continue
+		}
+		seen[phone] = true
+		members = append(members, GroupMember{PhoneNumber: phone, Name: member.Name})
+	}
+	return members, nil
+}
+
+// findGroup loads the group named by the :id path parameter, writing an error response on failure
+func findGroup(c *gin.Context) (Group, bool) {
+	var group Group
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, "Invalid group ID")
+		return group, false
+	}
+
+	if err := db.Scopes(forTenant(c)).Preload("Members").First(&group, uint(id)).Error; err != nil {
+		respondErrorCode(c, http.StatusNotFound, codeGroupNotFound, "Group not found")
+		return group, false
+	}
+	group.MemberCount = int64(len(group.Members))
+	return group, true
+}
+
+func createGroup(c *gin.Context) {
+	var req GroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+		return
+	}
+	members, apiErr := groupMembers(req)
+	if apiErr != nil {
+		respondAPIError(c, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	group := Group{TenantID: tenantID(c), Name: req.Name, Members: members}
+	if err := db.Create(&group).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create group")
+		return
+	}
+	group.MemberCount = int64(len(members))
+
+	respond(c, http.StatusCreated, group)
+}
+
+// getGroups lists the tenant's groups with their member counts
+func getGroups(c *gin.Context) {
+	var groups []Group
+	if err := db.Scopes(forTenant(c)).Order("name ASC").Find(&groups).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to fetch groups")
+		return
+	}
+
+	var counts []struct {
+		GroupID uint
+		Count   int64
+	}
+	err := db.Model(&GroupMember{}).
+		Select("group_id, COUNT(*) AS count").
+		Where("group_id IN (?)", db.Model(&Group{}).Scopes(forTenant(c)).Select("id")).
+		Group("group_id").
+		Scan(&counts).Error
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to fetch groups")
+		return
+	}
+	byGroup := make(map[uint]int64, len(counts))
+	for _, row := range counts {
+		byGroup[row.GroupID] = row.Count
+	}
+	for i := range groups {
+		groups[i].MemberCount = byGroup[groups[i].ID]
+	}
+
+	respond(c, http.StatusOK, groups)
+}
+
+func getGroup(c *gin.Context) {
+	group, ok := findGroup(c)
+	if !ok {
+		return
+	}
+	respond(c, http.StatusOK, group)
+}
+
+// updateGroup renames a group and replaces its members in one transaction
+func updateGroup(c *gin.Context) {
+	group, ok := findGroup(c)
+	if !ok {
+		return
+	}
+
+	var req GroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+		return
+	}
+	members, apiErr := groupMembers(req)
+	if apiErr != nil {
+		respondAPIError(c, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&GroupMember{}).Error; err != nil {
+			return err
+		}
+		for i := range members {
+			members[i].GroupID = group.ID
+		}
+		if len(members) > 0 {
+			if err := tx.Create(&members).Error; err != nil {
+				return err
+			}
+		}
+		group.Name = req.Name
+		group.Members = nil
+		return tx.Save(&group).Error
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to update group")
+		return
+	}
+	group.Members = members
+	group.MemberCount = int64(len(members))
+
+	respond(c, http.StatusOK, group)
+}
+
+// deleteGroup removes a group and its members; messages already scheduled to it are kept
+func deleteGroup(c *gin.Context) {
+	group, ok := findGroup(c)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&GroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Group{}, group.ID).Error
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to delete group")
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{"id": group.ID})
+}
+
+// scheduleGroup handles a schedule request addressed to a group, creating one message per
+// member in a single transaction
+func scheduleGroup(c *gin.Context, req ScheduleMessageRequest) {
+	if req.PhoneNumber != "" || req.Recurrence != "" || req.DedupeKey != "" {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, "group_id cannot be combined with phone_number, recurrence or dedupe_key")
+		return
+	}
+
+	var group Group
+	if err := db.Scopes(forTenant(c)).Preload("Members").First(&group, *req.GroupID).Error; err != nil {
+		respondErrorCode(c, http.StatusNotFound, codeGroupNotFound, "Group not found")
+		return
+	}
+	if len(group.Members) == 0 {
+		respondErrorCode(c, http.StatusBadRequest, codeGroupEmpty, "Group has no members")
+		return
+	}
+
+	messages := make([]Message, 0, len(group.Members))
+	for _, member := range group.Members {
+		item := req
+		item.GroupID = nil
+		item.PhoneNumber = member.PhoneNumber
+		scheduledAt, apiErr := validateScheduleRequest(&item)
+		if apiErr != nil {
+			respondAPIError(c, http.StatusBadRequest, apiErr)
+			return
+		}
+		message := newMessage(c, item, scheduledAt)
+		if apiErr := attachConsent(&message); apiErr != nil {
+			respondAPIError(c, consentErrorStatus(apiErr), apiErr)
+			return
+		}
+		message.GroupID = &group.ID
+		messages = append(messages, message)
+	}
+
+	pending := 0
+	for _, message := range messages {
+		if message.Status == "pending" {
+			pending++
+		}
+	}
+	if !checkBackpressure(c, pending) {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&messages).Error
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to schedule messages")
+		return
+	}
+
+	respond(c, http.StatusCreated, gin.H{
+		"group_id":      group.ID,
+		"message_count": len(messages),
+		"messages":      messages,
+	})
+}
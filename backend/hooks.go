@@ -0,0 +1,33 @@
+package main
+
+import "sync"
+
+// PreSendHook runs just before a due message is handed to Twilio and may modify it, e.g. to
+// enrich its content. Returning proceed=false skips the message (status skipped); an error
+// fails it. Hooks see variables already resolved.
+type PreSendHook func(message *Message) (proceed bool, err error)
+
+var preSendHooks []PreSendHook
+var preSendHooksMu sync.RWMutex
+
+// registerPreSendHook adds a hook run before every send, after those registered earlier.
+// No hooks are registered by default.
+func registerPreSendHook(hook PreSendHook) {
+	preSendHooksMu.Lock()
+	defer preSendHooksMu.Unlock()
+	preSendHooks = append(preSendHooks, hook)
+}
+
+// runPreSendHooks runs the registered hooks in order, stopping at the first that skips or fails
+func runPreSendHooks(message *Message) (bool, error) {
+	preSendHooksMu.RLock()
+	defer preSendHooksMu.RUnlock()
+
+	for _, hook := range preSendHooks {
+		proceed, err := hook(message)
+		if err != nil || !proceed {
+			return proceed, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm/clause"
+)
+
+// JobLock is a lease on a scheduled job run, so that when several instances share a
+// database only the one holding the lease performs the run
+type JobLock struct {
+	Name      string    `gorm:"primaryKey"`
+	Owner     string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// instanceID identifies this process as a lock owner
+var instanceID = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}()
+
+// jobLockTTL bounds how long a lease is held, from JOB_LOCK_TTL
+var jobLockTTL time.Duration
+
+// acquireJobLock takes the named lease unless another instance holds an unexpired one.
+// Leases are never released early: a peer whose clock runs slightly behind would
+// otherwise acquire the freed lease and repeat the run. They simply expire.
+func acquireJobLock(name string) bool {
+	now := time.Now().UTC()
+	db.Where("expires_at < ?", now).Delete(&JobLock{})
+
+	lock := JobLock{Name: name, Owner: instanceID, ExpiresAt: now.Add(jobLockTTL)}
+	result := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"owner", "expires_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Lt{Column: "job_locks.expires_at", Value: now}}},
+	}).Create(&lock)
+	if result.Error != nil {
+		log.Printf("Failed to acquire job lock %s: %v", name, result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+// systemJobs names the scheduler entries of housekeeping jobs, for the scheduler dump
+var systemJobs = make(map[cron.EntryID]string)
+var systemJobsMu sync.Mutex
+
+// registerSystemJob schedules a housekeeping job that runs on a single instance per fire
+func registerSystemJob(name, spec string, run func()) error {
+	entryID, err := scheduler.AddFunc(spec, func() {
+		if !acquireJobLock(name + ":" + time.Now().UTC().Truncate(time.Minute).Format(time.RFC3339)) {
+			return
+		}
+		run()
+	})
+	if err != nil {
+		return err
+	}
+
+	systemJobsMu.Lock()
+	systemJobs[entryID] = name
+	systemJobsMu.Unlock()
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	lookups "github.com/twilio/twilio-go/rest/lookups/v2"
+)
+
+const maxValidateNumbers = 1000
+
+// ValidateNumbersRequest lists numbers to check with Twilio Lookup before scheduling
+type ValidateNumbersRequest struct {
+	PhoneNumbers []string `json:"phone_numbers" binding:"required,min=1"`
+}
+
+// numberValidation is the outcome of validating one number
+type numberValidation struct {
+	Input          string `json:"input"`
+	Valid          bool   `json:"valid"`
+	PhoneNumber    string `json:"phone_number,omitempty"` // E.164
+	NationalFormat string `json:"national_format,omitempty"`
+	CountryCode    string `json:"country_code,omitempty"`
+	LineType       string `json:"line_type,omitempty"` // mobile, landline, voip, ... when Twilio knows it
+	Error          string `json:"error,omitempty"`
+	Cached         bool   `json:"cached"`
+}
+
+type cachedLookup struct {
+	result    numberValidation
+	expiresAt time.Time
+}
+
+// lookupCache remembers Lookup answers by E.164 number for LOOKUP_CACHE_TTL
+var lookupCache = make(map[string]cachedLookup)
+var lookupCacheMu sync.Mutex
+
+var lookupCacheTTL time.Duration
+var lookupConcurrency int
+var lookupRatePerSecond int
+
+// validateNumbers checks each number locally, then with Twilio Lookup (line type included),
+// running lookups concurrently under a shared rate limit
+func validateNumbers(c *gin.Context) {
+	var req ValidateNumbersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+		return
+	}
+	if len(req.PhoneNumbers) > maxValidateNumbers {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, "At most 1000 numbers can be validated per request")
+		return
+	}
+
+	results := make([]numberValidation, len(req.PhoneNumbers))
+	pending := make(map[string][]int) // E.164 number -> indexes awaiting its lookup
+	for i, input := range req.PhoneNumbers {
+		results[i].Input = input
+		phone, err := normalizePhoneNumber(input)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if cached, ok := cachedNumberLookup(phone); ok {
+			cached.Input = input
+			results[i] = cached
+			continue
+		}
+		pending[phone] = append(pending[phone], i)
+	}
+
+	limiter := time.NewTicker(time.Second / time.Duration(lookupRatePerSecond))
+	defer limiter.Stop()
+
+	numbers := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < lookupConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for phone := range numbers {
+				<-limiter.C
+				result := lookupNumber(phone)
+
+				mu.Lock()
+				for _, i := range pending[phone] {
+					input := results[i].Input
+					results[i] = result
+					results[i].Input = input
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for phone := range pending {
+		numbers <- phone
+	}
+	close(numbers)
+	wg.Wait()
+
+	valid := 0
+	for _, result := range results {
+		if result.Valid {
+			valid++
+		}
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"total":   len(results),
+		"valid":   valid,
+		"invalid": len(results) - valid,
+		"results": results,
+	})
+}
+
+// lookupNumber asks Twilio Lookup about one E.164 number, caching definitive answers
+func lookupNumber(phone string) numberValidation {
+	params := &lookups.FetchPhoneNumberParams{}
+	params.SetFields("line_type_intelligence")
+
+	resp, err := twilioClient.LookupsV2.FetchPhoneNumber(phone, params)
+	if err != nil {
+		// Not cached: a failed lookup says nothing about the number
+		return numberValidation{PhoneNumber: phone, Error: "lookup failed: " + err.Error()}
+	}
+
+	result := numberValidation{PhoneNumber: phone}
+	if resp.Valid != nil {
+		result.Valid = *resp.Valid
+	}
+	if resp.PhoneNumber != nil {
+		result.PhoneNumber = *resp.PhoneNumber
+	}
+	if resp.NationalFormat != nil {
+		result.NationalFormat = *resp.NationalFormat
+	}
+	if resp.CountryCode != nil {
+		result.CountryCode = *resp.CountryCode
+	}
+	if resp.LineTypeIntelligence != nil {
+		if lineType, ok := (*resp.LineTypeIntelligence)["type"].(string); ok {
+			result.LineType = lineType
+		}
+	}
+	if !result.Valid && resp.ValidationErrors != nil && len(*resp.ValidationErrors) > 0 {
+		result.Error = (*resp.ValidationErrors)[0]
+	}
+
+	lookupCacheMu.Lock()
+	lookupCache[phone] = cachedLookup{result: result, expiresAt: time.Now().Add(lookupCacheTTL)}
+	lookupCacheMu.Unlock()
+	return result
+}
+
+func cachedNumberLookup(phone string) (numberValidation, bool) {
+	lookupCacheMu.Lock()
+	defer lookupCacheMu.Unlock()
+
+	cached, ok := lookupCache[phone]
+	if !ok {
+		return numberValidation{}, false
+	}
+	if time.Now().After(cached.expiresAt) {
+		delete(lookupCache, phone)
+		return numberValidation{}, false
+	}
+	cached.result.Cached = true
+	return cached.result, true
+}
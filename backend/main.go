@@ -1,48 +1,141 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"runtime/debug"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
-	"os"
 
 	"github.com/gin-contrib/cors"
+	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
 	"github.com/robfig/cron/v3"
 	"github.com/twilio/twilio-go"
+	"github.com/twilio/twilio-go/client"
 	api "github.com/twilio/twilio-go/rest/api/v2010"
 	"gorm.io/driver/sqlite"
-	"github.com/joho/godotenv"
 	"gorm.io/gorm"
 )
 
 // Message represents a scheduled message
 type Message struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	PhoneNumber string    `json:"phone_number" gorm:"not null"`
-	Content     string    `json:"content" gorm:"not null"`
-	ScheduledAt time.Time `json:"scheduled_at" gorm:"not null"`
-	Status      string    `json:"status" gorm:"default:'pending'"` // pending, sent, failed
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID                 uint       `json:"id" gorm:"primaryKey"`
+	TenantID           string     `json:"-" gorm:"not null;default:'';index;uniqueIndex:idx_message_external_key,where:external_key <> ''"`
+	ExternalKey        string     `json:"external_key,omitempty" gorm:"not null;default:'';uniqueIndex:idx_message_external_key"` // caller's ID, set by PUT /schedule/by-key/:external_key
+	CampaignID         *uint      `json:"campaign_id" gorm:"index"`
+	RecurringID        *uint      `json:"recurring_id" gorm:"index"`
+	GroupID            *uint      `json:"group_id" gorm:"index"` // the group this message was fanned out from
+	PhoneNumber        string     `json:"phone_number" gorm:"not null"`
+	Content            string     `json:"content" gorm:"not null"`
+	Variant            string     `json:"variant,omitempty"`                               // A/B variant the content was drawn from
+	ContentSID         string     `json:"content_sid,omitempty" gorm:"column:content_sid"` // Twilio Content API template sent instead of Content
+	ContentVariables   string     `json:"content_variables,omitempty"`                     // JSON object of the template's variables
+	TwilioParams       string     `json:"twilio_params,omitempty"`                         // JSON object of whitelisted Create Message parameters
+	SendWindow         string     `json:"send_window,omitempty"`                           // JSON SendWindow the message may only be sent within
+	RenderedContent    string     `json:"rendered_content"`                                // exact body handed to Twilio, captured at send time
+	ContentKey         string     `json:"-"`                                               // content store keys of bodies kept outside the table
+	RenderedContentKey string     `json:"-"`
+	VariablesURL       string     `json:"variables_url,omitempty"` // send-time source of {{name}} variables
+	MediaKey           string     `json:"media_key,omitempty"`     // private media in MEDIA_STORE, sent as a signed URL
+	Account            string     `json:"account,omitempty"`       // named Twilio account from TWILIO_ACCOUNTS; empty uses the default
+	SentVia            string     `json:"sent_via,omitempty"`      // account that accepted the send, a fallback when the primary failed
+	Category           string     `json:"category,omitempty"`      // e.g. marketing or transactional; CONSENT_REQUIRED may demand consent per category
+	ConsentID          *uint      `json:"consent_id"`              // recorded consent of the recipient the message was scheduled under
+	MaxStaleness       int        `json:"max_staleness_seconds"`   // expire instead of sending this late; 0 never expires
+	SkipFooter         bool       `json:"skip_footer"`
+	Segments           int        `json:"segments"` // SMS segments of the rendered body, footer included
+	ScheduledAt        time.Time  `json:"scheduled_at" gorm:"not null"`
+	Status             string     `json:"status" gorm:"default:'pending'"` // draft, pending_approval, pending, processing, sent, failed, cancelled, expired, skipped, rejected
+	CreatedBy          string     `json:"-"`                               // requestActor of the key that created the message; it may not approve it
+	ReviewedBy         string     `json:"reviewed_by,omitempty"`           // approver who approved or rejected the message under APPROVAL_REQUIRED
+	ReviewedAt         *time.Time `json:"reviewed_at,omitempty"`
+	RejectionReason    string     `json:"rejection_reason,omitempty"`
+	AttemptCount       int        `json:"attempt_count" gorm:"not null;default:0"` // sends tried so far, across processor ticks
+	NextAttemptAt      *time.Time `json:"next_attempt_at"`                         // earliest time a re-queued failure is retried, or a held message's window opens
+	ClaimedAt          *time.Time `json:"claimed_at"`                              // when the processor last claimed the message for sending
+	LastError          string     `json:"last_error"`
+	ErrorCode          int        `json:"error_code,omitempty"`                      // Twilio error code of the last failure, when Twilio gave one
+	TwilioSID          string     `json:"twilio_sid" gorm:"column:twilio_sid;index"` // SID Twilio assigned when the message was accepted
+	DryRun             bool       `json:"dry_run"`                                   // "sent" to sent_log under DRY_RUN, never to Twilio
+	Price              *float64   `json:"price"`                                     // actual cost Twilio charged; null until Twilio reports it
+	PriceUnit          string     `json:"price_unit,omitempty"`                      // currency of Price, e.g. USD
+	SentAt             *time.Time `json:"sent_at" gorm:"index"`
+	DeliveredAt        *time.Time `json:"delivered_at"` // when the delivered receipt arrived
+	StatusUpdatedAt    *time.Time `json:"status_updated_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	EstimatedSendAt    *time.Time `json:"estimated_send_at,omitempty" gorm:"-"` // first processor tick at or after ScheduledAt
+
+	inlineContent         string // bodies moved to the content store during a save
+	inlineRenderedContent string
+	variables             map[string]string // fetched from VariablesURL just before sending
 }
 
 type TwilioConfig struct {
-	AccountSID string
-	AuthToken  string
-	FromNumber string
+	AccountSID        string
+	AuthToken         string
+	FromNumber        string
+	MessagingService  string // Messaging Service SID; when set Twilio picks the sender and FromNumber is unused
+	StatusCallbackURL string // where Twilio posts delivery receipts; points at /api/message-status
+}
+
+// RetryConfig controls how transient send failures are re-queued
+type RetryConfig struct {
+	MaxAttempts int           // total attempts across ticks; 1 disables re-queueing
+	BaseDelay   time.Duration // delay before the first re-queued attempt, doubled each time
+	MaxDelay    time.Duration
 }
 
 var twilioClient *twilio.RestClient
 var twilioConfig TwilioConfig
+var retryConfig RetryConfig
+
+// maxPending caps the pending backlog; scheduling returns 503 beyond it. 0 disables the guard.
+var maxPending int64
+
+// scheduleGrace is how far in the past a send time may be and still be accepted as "now", from
+// SCHEDULE_GRACE. It absorbs clock skew and request latency for "send in a few seconds" requests.
+var scheduleGrace time.Duration
+
+// maxScheduleHorizon caps how far ahead a message may be scheduled, from MAX_SCHEDULE_HORIZON; 0 disables the cap
+var maxScheduleHorizon time.Duration
 
 // ScheduleMessageRequest represents the request body for scheduling a message
 type ScheduleMessageRequest struct {
-	PhoneNumber string `json:"phone_number" binding:"required"`
-	Content     string `json:"content" binding:"required"`
-	ScheduledAt string `json:"scheduled_at" binding:"required"` // ISO format
+	PhoneNumber string `json:"phone_number"` // required unless GroupID is set
+	GroupID     *uint  `json:"group_id"`     // schedule one message per member of this group instead
+	Content     string `json:"content"`      // required unless ContentSID is set
+
+	ContentSID       string            `json:"content_sid"`       // approved Twilio Content API template, e.g. for WhatsApp
+	ContentVariables map[string]string `json:"content_variables"` // template variables keyed by placeholder, e.g. {"1": "Ana"}
+	Variants         []MessageVariant  `json:"variants"`          // A/B content, one variant drawn per recipient instead of content
+	TwilioParams     map[string]string `json:"twilio_params"`     // extra Twilio parameters, see twilioParamSetters
+	SendWindow       *SendWindow       `json:"send_window"`       // days and hours the message may go out in; late messages wait for them
+
+	ScheduledAt  string `json:"scheduled_at"`  // ISO format; required unless Draft
+	Timezone     string `json:"timezone"`      // IANA zone for scheduled_at or anchor_at given without an offset; defaults to the server's
+	SkipFooter   bool   `json:"skip_footer"`   // opt this message out of MESSAGE_FOOTER
+	Recurrence   string `json:"recurrence"`    // optional preset name, see recurrencePresets
+	VariablesURL string `json:"variables_url"` // optional; fetched at send time for {{name}} placeholders
+	MaxStaleness string `json:"max_staleness"` // optional duration; past scheduled_at by more than this the message expires unsent
+	Draft        bool   `json:"draft"`         // store as a draft, sent only after POST /messages/:id/activate
+	AnchorAt     string `json:"anchor_at"`     // with Offset, replaces scheduled_at: the message goes out at anchor_at + offset
+	MediaKey     string `json:"media_key"`     // optional storage key of a private MMS attachment
+	DedupeKey    string `json:"dedupe_key"`    // while live, scheduling again with this key returns the first message
+	DedupeTTL    string `json:"dedupe_ttl"`    // how long dedupe_key stays live, e.g. 12h or 7d
+	Account      string `json:"account"`       // optional named Twilio account to send through
+	Category     string `json:"category"`      // optional message category, checked against CONSENT_REQUIRED
+	Offset       string `json:"offset"`        // duration such as 36h, or days such as 7d
+
+	anchorPassed bool // anchor_at + offset was already past; the message is stored expired
 }
 
 var db *gorm.DB
@@ -50,16 +143,26 @@ var scheduler *cron.Cron
 
 func main() {
 	if err := godotenv.Load(); err != nil {
-    log.Println("No .env file found, using system environment variables")
-}
+		log.Println("No .env file found, using system environment variables")
+	}
 	// Initialize database
 	initDB()
+	loadSendingPaused()
+
+	twilioBreaker = newCircuitBreaker(getEnvInt("BREAKER_FAILURE_THRESHOLD", 5), getEnvDuration("BREAKER_COOLDOWN", time.Minute))
+
+	jobLockTTL = getEnvDuration("JOB_LOCK_TTL", 10*time.Minute)
 
 	// Initialize scheduler
 	scheduler = cron.New()
+	registerRecurringMessages()
+	registerArchiveJob()
+	registerCleanupJob()
 	scheduler.Start()
 
 	// Start background job to check for pending messages
+	processorInterval = getEnvDuration("PROCESSOR_INTERVAL", 30*time.Second)
+	processorStartedAt = time.Now().UTC()
 	go messageProcessor()
 
 	// Initialize Gin router
@@ -74,262 +177,1387 @@ func main() {
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
+	r.Use(auditHTTPRequests())
 
 	// Initialize Twilio client
 	twilioConfig = TwilioConfig{
-		AccountSID: os.Getenv("TWILIO_ACCOUNT_SID"),
-		AuthToken:  os.Getenv("TWILIO_AUTH_TOKEN"),
-		FromNumber: os.Getenv("TWILIO_PHONE_NUMBER"),
+		AccountSID:        os.Getenv("TWILIO_ACCOUNT_SID"),
+		AuthToken:         os.Getenv("TWILIO_AUTH_TOKEN"),
+		FromNumber:        os.Getenv("TWILIO_PHONE_NUMBER"),
+		MessagingService:  os.Getenv("TWILIO_MESSAGING_SERVICE_SID"),
+		StatusCallbackURL: os.Getenv("STATUS_CALLBACK_URL"),
 	}
 
-	if twilioConfig.AccountSID == "" || twilioConfig.AuthToken == "" || twilioConfig.FromNumber == "" {
-		log.Fatal("Twilio configuration missing. Please set TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN, and TWILIO_PHONE_NUMBER environment variables")
+	if twilioConfig.AccountSID == "" || twilioConfig.AuthToken == "" {
+		log.Fatal("Twilio configuration missing. Please set TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN environment variables")
+	}
+	if twilioConfig.FromNumber == "" && twilioConfig.MessagingService == "" {
+		log.Fatal("Twilio sender missing. Please set TWILIO_PHONE_NUMBER or TWILIO_MESSAGING_SERVICE_SID")
 	}
 
-	twilioClient = twilio.NewRestClientWithParams(twilio.ClientParams{
-		Username: twilioConfig.AccountSID,
-		Password: twilioConfig.AuthToken,
-	})
+	twilioClient = newTwilioClient(twilioConfig)
+	loadTwilioAccounts()
+	loadFallbackAccounts()
+
+	retryConfig = RetryConfig{
+		MaxAttempts: getEnvInt("MAX_SEND_ATTEMPTS", 1),
+		BaseDelay:   getEnvDuration("RETRY_BASE_DELAY", time.Minute),
+		MaxDelay:    getEnvDuration("RETRY_MAX_DELAY", time.Hour),
+	}
+
+	apiKeys = loadAPIKeys()
+	adminKeys = loadAdminKeys()
+	loadDefaultCountryCode()
+	initStatusWebhook()
+	loadStatusCoalescer()
+	loadFailureAlerter()
+	loadContentBlocklist()
+	loadContentStore()
+	loadMediaStore()
+	maxPending = int64(getEnvInt("MAX_PENDING", 0))
+	maxScheduleHorizon = getEnvDuration("MAX_SCHEDULE_HORIZON", 365*24*time.Hour)
+	scheduleGrace = max(getEnvDuration("SCHEDULE_GRACE", 5*time.Second), 0)
+	minInterMessageGap = max(getEnvDuration("MIN_INTER_MESSAGE_GAP", 0), 0)
+	uploadMaxBytes = int64(getEnvInt("UPLOAD_MAX_BYTES", 1<<20))
+	allowTestSend = getEnvBool("ALLOW_TEST_SEND", false)
+	maskPhoneNumbers = getEnvBool("MASK_PHONE_NUMBERS", false)
+	auditHTTP = getEnvBool("AUDIT_HTTP", false)
+	strictJSON = getEnvBool("STRICT_JSON", false)
+	dryRun = getEnvBool("DRY_RUN", false)
+	if dryRun {
+		log.Println("DRY_RUN is on: messages are recorded in sent_log and never sent through Twilio")
+	}
+	loadApprovalConfig()
+	loadConsentConfig()
+	lookupCacheTTL = getEnvDuration("LOOKUP_CACHE_TTL", 24*time.Hour)
+	lookupConcurrency = max(getEnvInt("LOOKUP_CONCURRENCY", 4), 1)
+	lookupRatePerSecond = max(getEnvInt("LOOKUP_RATE_PER_SECOND", 10), 1)
+	variablesHTTPClient.Timeout = getEnvDuration("VARIABLES_TIMEOUT", 5*time.Second)
+	variablesAllowPrivate = getEnvBool("VARIABLES_ALLOW_PRIVATE", false)
+	receiptSecret = os.Getenv("RECEIPT_SECRET")
+	deliverySLA = getEnvDuration("DELIVERY_SLA", 5*time.Minute)
+	pricePerSegment = getEnvFloat("PRICE_PER_SEGMENT", 0)
+	priceCurrency = getEnvString("PRICE_CURRENCY", "USD")
+	messageFooter = os.Getenv("MESSAGE_FOOTER")
+	startBalanceMonitor(getEnvDuration("BALANCE_CHECK_INTERVAL", 15*time.Minute), getEnvFloat("MIN_BALANCE", 0))
+	startPricePoller(getEnvDuration("PRICE_POLL_INTERVAL", 10*time.Minute), getEnvDuration("PRICE_POLL_MAX_AGE", 72*time.Hour))
+
+	// Messages a crashed run left claimed would otherwise never be sent. Recovery asks Twilio
+	// about them unless DRY_RUN is on, so it runs once the clients and send settings are loaded.
+	stuckTimeout = getEnvDuration("STUCK_TIMEOUT", 10*time.Minute)
+	if _, err := recoverStuckMessages(stuckTimeout); err != nil {
+		log.Printf("Failed to recover stuck messages: %v", err)
+	}
 
 	// Routes
-	r.POST("/api/schedule", scheduleMessage)
+	r.GET("/healthz", healthz)
+
+	// Signed media links are fetched by Twilio, so they carry their own credential instead of an API key
+	r.GET("/media/*key", serveSignedMedia)
+
+	// The Twilio status webhook is called by Twilio itself and cannot carry an API key
 	r.POST("/api/message-status", handleMessageStatus)
-	r.GET("/api/messages", getMessages)
-	r.PUT("/api/messages/:id", updateMessage)
-	r.DELETE("/api/messages/:id", deleteMessage)
+
+	authed := r.Group("/api", apiKeyAuth())
+
+	// List and report responses can be large; compress them for clients sending Accept-Encoding: gzip
+	compressed := gzip.Gzip(gzip.DefaultCompression)
+	authed.POST("/schedule", scheduleMessage)
+	authed.POST("/schedule/upload", uploadSchedule)
+	authed.PUT("/schedule/by-key/:external_key", upsertMessageByKey)
+	authed.GET("/messages", compressed, getMessages)
+	authed.GET("/messages/upcoming", compressed, getUpcomingMessages)
+	authed.GET("/messages/calendar", compressed, getMessageCalendar)
+	authed.GET("/messages/next", getNextMessage)
+	authed.POST("/messages/reschedule-failed", rescheduleFailed)
+	authed.POST("/messages/batch-get", compressed, batchGetMessages)
+	authed.GET("/messages/:id", getMessage)
+	authed.GET("/messages/:id/receipt", getMessageReceipt)
+	authed.POST("/messages/:id/activate", activateDraft)
+	authed.POST("/messages/:id/duplicate", duplicateMessage)
+	authed.POST("/messages/:id/approve", approveMessage)
+	authed.POST("/messages/:id/reject", rejectMessage)
+	authed.PUT("/messages/:id", updateMessage)
+	authed.DELETE("/messages/:id", deleteMessage)
+	authed.POST("/estimate", estimateCost)
+	authed.POST("/send-test", sendTest)
+	authed.POST("/validate-numbers", validateNumbers)
+	authed.GET("/recipients/:phone/messages", compressed, getRecipientMessages)
+	authed.GET("/recipients/:phone/consent", getRecipientConsent)
+	authed.POST("/consent", recordConsent)
+	authed.DELETE("/consent/:id", revokeConsent)
+	authed.POST("/recipients/:phone/cancel-pending", cancelRecipientPending)
+	authed.GET("/recurring", compressed, getRecurringMessages)
+	authed.POST("/groups", createGroup)
+	authed.GET("/groups", compressed, getGroups)
+	authed.GET("/groups/:id", getGroup)
+	authed.PUT("/groups/:id", updateGroup)
+	authed.DELETE("/groups/:id", deleteGroup)
+	authed.DELETE("/recurring/:id", stopRecurringMessage)
+	authed.POST("/campaigns", createCampaign)
+	authed.GET("/campaigns/:id", getCampaign)
+	authed.POST("/campaigns/:id/cancel", cancelCampaign)
+	authed.POST("/campaigns/:id/shift", shiftCampaign)
+	authed.GET("/campaigns/:id/progress", compressed, getCampaignProgress)
+	authed.GET("/reports/throughput", compressed, getThroughputReport)
+	authed.GET("/reports/sla", compressed, getSLAReport)
+	authed.GET("/reports/failures", compressed, getFailureReport)
+	authed.GET("/reports/cost", compressed, getCostReport)
+	authed.GET("/reports/heatmap", compressed, getHeatmapReport)
+	authed.GET("/reports/variants", compressed, getVariantReport)
+	authed.GET("/metrics/lag", getLagMetrics)
+	authed.GET("/sent-log", compressed, getSentLog)
+
+	// Operator endpoints act on every tenant's messages or hold shared secrets, so they take an admin key instead
+	admin := r.Group("/api/admin", adminAuth())
+	admin.POST("/pause", pauseSending)
+	admin.POST("/resume", resumeSending)
+	admin.GET("/scheduler", getSchedulerEntries)
+	admin.POST("/recover-stuck", recoverStuck)
+	admin.POST("/process-now", processNow)
+	admin.GET("/webhook-secret", getWebhookSecret)
+	admin.POST("/webhook-secret/rotate", rotateWebhookSecret)
+
+	// An explicit server so slow or stalled clients cannot hold connections open indefinitely.
+	// WriteTimeout bounds whole handlers, so keep it above the slowest one (large uploads, lookups).
+	server := &http.Server{
+		Addr:              ":8080",
+		Handler:           r,
+		ReadHeaderTimeout: getEnvDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       getEnvDuration("HTTP_READ_TIMEOUT", 30*time.Second),
+		WriteTimeout:      getEnvDuration("HTTP_WRITE_TIMEOUT", 60*time.Second),
+		IdleTimeout:       getEnvDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+	}
 
 	fmt.Println("Server starting on :8080")
-	log.Fatal(r.Run(":8080"))
+	log.Fatal(server.ListenAndServe())
 }
 
 func initDB() {
 	var err error
-	db, err = gorm.Open(sqlite.Open("messages.db"), &gorm.Config{})
+	if db, err = openDB("messages.db"); err != nil {
+		log.Fatal("Failed to open database:", err)
+	}
+
+	if err := normalizeStoredTimes(); err != nil {
+		log.Fatal("Failed to normalize stored times:", err)
+	}
+}
+
+// openDB opens the SQLite database at path and migrates the schema
+func openDB(path string) (*gorm.DB, error) {
+	conn, err := gorm.Open(sqlite.Open(path), &gorm.Config{
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = conn.AutoMigrate(&Message{}, &Campaign{}, &Setting{}, &RecurringMessage{}, &JobLock{}, &SentLog{}, &Group{}, &GroupMember{}, &DedupeKey{}, &Consent{}, &StatusChange{})
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		return nil, err
 	}
+	return conn, nil
+}
 
-	// Migrate the schema
-	err = db.AutoMigrate(&Message{})
+// normalizeStoredTimes rewrites message timestamps saved with a non-UTC offset.
+// SQLite keeps times as text, so "scheduled_at <= ?" is only correct when every row shares one offset.
+func normalizeStoredTimes() error {
+	var messages []Message
+	utc := "%+00:00"
+	err := db.Where("scheduled_at NOT LIKE ? OR created_at NOT LIKE ? OR updated_at NOT LIKE ?", utc, utc, utc).
+		Or("sent_at NOT LIKE ? OR next_attempt_at NOT LIKE ? OR delivered_at NOT LIKE ?", utc, utc, utc).
+		Or("claimed_at NOT LIKE ? OR status_updated_at NOT LIKE ? OR reviewed_at NOT LIKE ?", utc, utc, utc).
+		Find(&messages).Error
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		return err
 	}
+
+	for _, message := range messages {
+		updates := map[string]interface{}{
+			"scheduled_at": message.ScheduledAt.UTC(),
+			"created_at":   message.CreatedAt.UTC(),
+			"updated_at":   message.UpdatedAt.UTC(),
+		}
+		// Optional times are compared as text too, e.g. claimed_at by the stuck-claim recovery
+		for column, value := range map[string]*time.Time{
+			"next_attempt_at":   message.NextAttemptAt,
+			"sent_at":           message.SentAt,
+			"delivered_at":      message.DeliveredAt,
+			"claimed_at":        message.ClaimedAt,
+			"status_updated_at": message.StatusUpdatedAt,
+			"reviewed_at":       message.ReviewedAt,
+		} {
+			if value != nil {
+				updates[column] = value.UTC()
+			}
+		}
+		if err := db.Model(&Message{}).Where("id = ?", message.ID).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(messages) > 0 {
+		log.Printf("Normalized timestamps of %d messages to UTC", len(messages))
+	}
+	return nil
 }
 
 func scheduleMessage(c *gin.Context) {
 	var req ScheduleMessageRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindScheduleJSON(c, &req) {
+		return
+	}
+	if req.GroupID != nil {
+		scheduleGroup(c, req)
 		return
 	}
 
-	// Parse scheduled time
-	scheduledAt, err := time.Parse(time.RFC3339, req.ScheduledAt)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use ISO 8601 format."})
+	scheduledAt, apiErr := validateScheduleRequest(&req)
+	if apiErr != nil {
+		respondAPIError(c, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	message := newMessage(c, req, scheduledAt)
+	if apiErr := attachConsent(&message); apiErr != nil {
+		respondAPIError(c, consentErrorStatus(apiErr), apiErr)
 		return
 	}
 
-	// Check if scheduled time is in the future
-	if scheduledAt.Before(time.Now()) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Scheduled time must be in the future"})
+	if req.Recurrence != "" {
+		if req.Draft {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, "Recurring messages cannot be drafts")
+			return
+		}
+		scheduleRecurring(c, req, scheduledAt)
 		return
 	}
 
-	// Create message
+	if !req.Draft && !req.anchorPassed && !checkBackpressure(c, 1) {
+		return
+	}
+
+	if req.DedupeKey != "" {
+		ttl, _ := parseDedupeTTL(&req)
+		duplicate, err := createDeduplicated(c, &message, req.DedupeKey, ttl)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to schedule message")
+			return
+		}
+		if duplicate {
+			respondDeduplicated(c, message)
+			return
+		}
+	} else if err := db.Create(&message).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to schedule message")
+		return
+	}
+
+	if message.Status == "pending" {
+		estimate := estimatedSendAt(message.ScheduledAt)
+		message.EstimatedSendAt = &estimate
+	}
+	respond(c, http.StatusCreated, message)
+}
+
+// newMessage builds a pending (or pending_approval) message from a validated request, or a draft or
+// expired one as it asks
+func newMessage(c *gin.Context, req ScheduleMessageRequest, scheduledAt time.Time) Message {
 	message := Message{
-		PhoneNumber: req.PhoneNumber,
-		Content:     req.Content,
-		ScheduledAt: scheduledAt,
-		Status:      "pending",
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		TenantID:     tenantID(c),
+		CreatedBy:    requestActor(c),
+		PhoneNumber:  req.PhoneNumber,
+		Content:      req.Content,
+		ContentSID:   req.ContentSID,
+		SkipFooter:   req.SkipFooter,
+		VariablesURL: req.VariablesURL,
+		MediaKey:     req.MediaKey,
+		Account:      req.Account,
+		Category:     req.Category,
+		ScheduledAt:  scheduledAt,
+		Status:       queuedStatus(),
+		CreatedAt:    time.Now().UTC(),
+		UpdatedAt:    time.Now().UTC(),
+	}
+	if req.Draft {
+		message.Status = "draft"
+	}
+	if req.anchorPassed {
+		now := message.CreatedAt
+		message.Status = "expired"
+		message.LastError = "anchor_at + offset was already in the past when scheduled"
+		message.StatusUpdatedAt = &now
+	}
+	message.MaxStaleness, _ = parseMaxStaleness(req.MaxStaleness)
+	if len(req.Variants) > 0 {
+		variant := pickVariant(req.Variants)
+		message.Content = variant.Content
+		message.Variant = variant.Name
+	}
+	message.ContentVariables, _ = validateContentTemplate(&req)
+	message.TwilioParams, _ = validateTwilioParams(req.TwilioParams)
+	message.SendWindow, _ = validateSendWindow(req.SendWindow, req.Timezone)
+	if message.ContentSID == "" {
+		message.Segments, _ = countSegments(renderContent(message))
+	}
+	return message
+}
+
+// parseMaxStaleness converts a max_staleness duration to whole seconds, 0 when unset
+func parseMaxStaleness(raw string) (int, *apiError) {
+	if raw == "" {
+		return 0, nil
+	}
+	staleness, err := time.ParseDuration(raw)
+	if err != nil || staleness < time.Second {
+		return 0, &apiError{Code: codeInvalidDuration, Message: "max_staleness must be a duration of at least 1s, such as 15m"}
+	}
+	return int(staleness / time.Second), nil
+}
+
+// validateScheduleRequest checks a new message request, normalizing its phone number in place,
+// and returns its send time or an error describing the first problem found
+func validateScheduleRequest(req *ScheduleMessageRequest) (time.Time, *apiError) {
+	// Only POST /schedule expands groups, before validating each member's message
+	if req.GroupID != nil {
+		return time.Time{}, &apiError{Code: codeInvalidParameter, Message: "group_id is only accepted by POST /api/schedule"}
+	}
+	phone, err := normalizePhoneNumber(req.PhoneNumber)
+	if err != nil {
+		return time.Time{}, &apiError{Code: codeInvalidPhoneNumber, Message: err.Error()}
+	}
+	req.PhoneNumber = phone
+
+	// Drafts get their send time on activation
+	var scheduledAt time.Time
+	if req.AnchorAt != "" || req.Offset != "" {
+		if req.Draft || req.Recurrence != "" {
+			return time.Time{}, &apiError{Code: codeInvalidParameter, Message: "anchor_at and offset cannot be used with drafts or recurring messages"}
+		}
+		var apiErr *apiError
+		if scheduledAt, req.anchorPassed, apiErr = resolveAnchoredTime(req); apiErr != nil {
+			return time.Time{}, apiErr
+		}
+	} else if req.ScheduledAt != "" || !req.Draft {
+		var apiErr *apiError
+		if scheduledAt, apiErr = parseScheduledAt(req.ScheduledAt, req.Timezone); apiErr != nil {
+			return time.Time{}, apiErr
+		}
+	}
+
+	if apiErr := validateVariants(req); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+	if _, apiErr := validateContentTemplate(req); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+	if _, apiErr := validateTwilioParams(req.TwilioParams); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+	if len(req.TwilioParams) > 0 && req.Recurrence != "" {
+		return time.Time{}, &apiError{Code: codeInvalidParameter, Message: "twilio_params cannot be used with recurrence"}
+	}
+	if _, apiErr := validateSendWindow(req.SendWindow, req.Timezone); apiErr != nil {
+		return time.Time{}, apiErr
 	}
+	if req.SendWindow != nil && req.Recurrence != "" {
+		return time.Time{}, &apiError{Code: codeInvalidParameter, Message: "send_window cannot be used with recurrence"}
+	}
+	if term, blocked := findBlockedTerm(req.Content); blocked {
+		return time.Time{}, blockedContentError(term)
+	}
+	if apiErr := validateVariablesURL(req.VariablesURL); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+	if apiErr := validateMediaKey(req.MediaKey); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+	if apiErr := validateAccount(req.Account); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+	if _, apiErr := parseDedupeTTL(req); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+	if req.DedupeKey != "" && req.Recurrence != "" {
+		return time.Time{}, &apiError{Code: codeInvalidParameter, Message: "dedupe_key cannot be used with recurrence"}
+	}
+	if _, apiErr := parseMaxStaleness(req.MaxStaleness); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+
+	return scheduledAt, nil
+}
+
+// parseScheduledAt parses a requested send time, which must lie in the future and within the horizon.
+// Zone-less times are taken in timezone, or the server's zone when it is empty.
+func parseScheduledAt(raw, timezone string) (time.Time, *apiError) {
+	if raw == "" {
+		return time.Time{}, &apiError{Code: codeScheduledAtRequired, Message: "scheduled_at is required"}
+	}
+
+	// Parse scheduled time, storing it in UTC so SQLite's string comparisons order it correctly
+	scheduledAt, apiErr := parseSendTime(raw, timezone)
+	if apiErr != nil {
+		return time.Time{}, apiErr
+	}
+
+	// Check if scheduled time is in the future, allowing "now" and times that passed in transit
+	scheduledAt, inPast := applyScheduleGrace(scheduledAt)
+	if inPast {
+		return time.Time{}, &apiError{Code: codeScheduledInPast, Message: "Scheduled time must be in the future"}
+	}
+	if apiErr := checkScheduleHorizon(scheduledAt); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+	return scheduledAt, nil
+}
+
+// applyScheduleGrace moves a send time up to SCHEDULE_GRACE in the past to now, so it fires on
+// the next processor tick, and reports whether the time lies further back than that
+func applyScheduleGrace(scheduledAt time.Time) (time.Time, bool) {
+	now := time.Now().UTC()
+	if !scheduledAt.Before(now) {
+		return scheduledAt, false
+	}
+	if scheduledAt.Before(now.Add(-scheduleGrace)) {
+		return scheduledAt, true
+	}
+	return now, false
+}
+
+// checkScheduleHorizon rejects times further ahead than MAX_SCHEDULE_HORIZON, which are
+// almost always a mistyped year
+func checkScheduleHorizon(scheduledAt time.Time) *apiError {
+	if maxScheduleHorizon <= 0 {
+		return nil
+	}
+
+	latest := time.Now().UTC().Add(maxScheduleHorizon)
+	if scheduledAt.After(latest) {
+		return &apiError{
+			Code:    codeScheduledTooFar,
+			Message: "Scheduled time is too far in the future",
+			Details: gin.H{"max_horizon": maxScheduleHorizon.String(), "latest": latest},
+		}
+	}
+	return nil
+}
 
-	result := db.Create(&message)
+// checkBackpressure responds with 503 and returns false when accepting incoming more
+// messages would push the pending backlog over MAX_PENDING
+func checkBackpressure(c *gin.Context, incoming int) bool {
+	if maxPending <= 0 {
+		return true
+	}
+
+	var depth int64
+	if err := db.Model(&Message{}).Where("status = ?", "pending").Count(&depth).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check pending backlog")
+		return false
+	}
+	if depth+int64(incoming) > maxPending {
+		respondAPIError(c, http.StatusServiceUnavailable, &apiError{
+			Code:    codeBacklogFull,
+			Message: "Too many pending messages, try again later",
+			Details: gin.H{"pending_count": depth, "max_pending": maxPending},
+		})
+		return false
+	}
+	return true
+}
+
+// messageSortColumns are the columns GET /messages may sort by, so sort is never interpolated into SQL
+var messageSortColumns = map[string]string{
+	"scheduled_at": "scheduled_at",
+	"created_at":   "created_at",
+	"status":       "status",
+}
+
+// getMessages lists messages, newest scheduled first by default, optionally filtered by status
+// and by a scheduled_from (inclusive) / scheduled_to (exclusive) range
+func getMessages(c *gin.Context) {
+	sortColumn, ok := messageSortColumns[c.DefaultQuery("sort", "scheduled_at")]
+	if !ok {
+		respondAPIError(c, http.StatusBadRequest, &apiError{
+			Code:    codeInvalidParameter,
+			Message: "Unknown sort column",
+			Details: gin.H{"sort": c.Query("sort"), "allowed": []string{"scheduled_at", "created_at", "status"}},
+		})
+		return
+	}
+	direction := strings.ToUpper(c.DefaultQuery("order", "desc"))
+	if direction != "ASC" && direction != "DESC" {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, "order must be asc or desc")
+		return
+	}
+
+	query := db.Scopes(forTenant(c))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var from, to time.Time
+	var err error
+	if value := c.Query("scheduled_from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidDate, "Invalid scheduled_from. Use ISO 8601 format.")
+			return
+		}
+		query = query.Where("scheduled_at >= ?", from.UTC())
+	}
+	if value := c.Query("scheduled_to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidDate, "Invalid scheduled_to. Use ISO 8601 format.")
+			return
+		}
+		query = query.Where("scheduled_at < ?", to.UTC())
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidDateRange, "scheduled_from must be before scheduled_to")
+		return
+	}
+
+	page, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	if page != nil {
+		if query, err = paginate(query, &Message{}, page); err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to fetch messages")
+			return
+		}
+	}
+
+	var messages []Message
+	result := query.Order(sortColumn + " " + direction).Order("id " + direction).Find(&messages)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule message"})
+		respondError(c, http.StatusInternalServerError, "Failed to fetch messages")
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "Message scheduled successfully",
-		"data":    message,
-	})
+	respondPage(c, messages, page)
 }
 
-func getMessages(c *gin.Context) {
+// getUpcomingMessages lists pending messages due within the given window, soonest first
+func getUpcomingMessages(c *gin.Context) {
+	within, err := time.ParseDuration(c.DefaultQuery("within", "10m"))
+	if err != nil || within <= 0 {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidDuration, "Invalid within duration. Use a positive duration such as 10m or 2h.")
+		return
+	}
+
+	now := time.Now().UTC()
 	var messages []Message
-	result := db.Order("scheduled_at DESC").Find(&messages)
+	result := db.Scopes(forTenant(c)).
+		Where("status = ? AND scheduled_at BETWEEN ? AND ?", "pending", now, now.Add(within)).
+		Order("scheduled_at ASC").
+		Find(&messages)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+		respondError(c, http.StatusInternalServerError, "Failed to fetch messages")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"messages": messages,
+	respond(c, http.StatusOK, messages)
+}
+
+// getNextMessage returns the pending message that will be sent soonest, or 204 when none is pending
+func getNextMessage(c *gin.Context) {
+	var messages []Message
+	// A re-queued retry goes out at its next attempt, not its original scheduled time
+	result := db.Scopes(forTenant(c)).
+		Where("status = ?", "pending").
+		Order("COALESCE(next_attempt_at, scheduled_at) ASC").
+		Limit(1).
+		Find(&messages)
+	if result.Error != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to fetch messages")
+		return
+	}
+	if len(messages) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	message := messages[0]
+	due := message.ScheduledAt
+	if message.NextAttemptAt != nil {
+		due = *message.NextAttemptAt
+	}
+	estimate := estimatedSendAt(due)
+	message.EstimatedSendAt = &estimate
+
+	respond(c, http.StatusOK, gin.H{
+		"message":        message,
+		"eta_seconds":    max(time.Until(estimate).Seconds(), 0),
+		"sending_paused": sendingPaused.Load(),
 	})
 }
 
-func updateMessage(c *gin.Context) {
+// getMessage returns a single message, including the content it was sent with
+func getMessage(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidMessageID, "Invalid message ID")
 		return
 	}
 
-	var req ScheduleMessageRequest
+	var message Message
+	if err := db.Scopes(forTenant(c)).First(&message, uint(id)).Error; err != nil {
+		respondErrorCode(c, http.StatusNotFound, codeMessageNotFound, "Message not found")
+		return
+	}
+
+	respond(c, http.StatusOK, message)
+}
+
+// maxBatchGetMessages caps the IDs one POST /messages/batch-get may ask for
+const maxBatchGetMessages = 500
+
+// BatchGetMessagesRequest lists the messages a dashboard wants refreshed
+type BatchGetMessagesRequest struct {
+	IDs []uint `json:"ids" binding:"required,min=1"`
+}
+
+// batchGetMessages returns the tenant's messages among the requested IDs in request order,
+// listing the IDs that matched nothing separately
+func batchGetMessages(c *gin.Context) {
+	var req BatchGetMessagesRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+		return
+	}
+	if len(req.IDs) > maxBatchGetMessages {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, fmt.Sprintf("At most %d messages can be fetched per request", maxBatchGetMessages))
 		return
 	}
 
-	// Parse scheduled time
-	scheduledAt, err := time.Parse(time.RFC3339, req.ScheduledAt)
+	var found []Message
+	if err := db.Scopes(forTenant(c)).Where("id IN ?", req.IDs).Find(&found).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to fetch messages")
+		return
+	}
+	byID := make(map[uint]Message, len(found))
+	for _, message := range found {
+		byID[message.ID] = message
+	}
+
+	messages := make([]Message, 0, len(found))
+	notFound := []uint{}
+	seen := make(map[uint]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if message, ok := byID[id]; ok {
+			messages = append(messages, message)
+		} else {
+			notFound = append(notFound, id)
+		}
+	}
+
+	respond(c, http.StatusOK, gin.H{"messages": messages, "not_found": notFound})
+}
+
+func updateMessage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidMessageID, "Invalid message ID")
+		return
+	}
+
+	var req ScheduleMessageRequest
+	if !bindScheduleJSON(c, &req) {
+		return
+	}
+	scheduledAt, apiErr := validateMessageUpdate(&req)
+	if apiErr != nil {
+		respondAPIError(c, http.StatusBadRequest, apiErr)
 		return
 	}
 
 	// Find and update message
 	var message Message
-	result := db.First(&message, uint(id))
+	result := db.Scopes(forTenant(c)).First(&message, uint(id))
 	if result.Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		respondErrorCode(c, http.StatusNotFound, codeMessageNotFound, "Message not found")
 		return
 	}
 
-	// Only allow updates if message is still pending
-	if message.Status != "pending" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot update sent or failed messages"})
+	// Only allow updates if message is still pending; drafts stay drafts
+	if !messageEditable(message) {
+		respondErrorCode(c, http.StatusBadRequest, codeMessageNotEditable, "Cannot update sent or failed messages")
 		return
 	}
 
+	applyMessageUpdate(&message, req, scheduledAt)
+	if apiErr := attachConsent(&message); apiErr != nil {
+		respondAPIError(c, consentErrorStatus(apiErr), apiErr)
+		return
+	}
+	db.Save(&message)
+
+	if message.Status == "pending" {
+		estimate := estimatedSendAt(message.ScheduledAt)
+		message.EstimatedSendAt = &estimate
+	}
+	respond(c, http.StatusOK, message)
+}
+
+// messageEditable reports whether a message has not been handed to the processor yet
+func messageEditable(message Message) bool {
+	return message.Status == "pending" || message.Status == "pending_approval" || message.Status == "draft"
+}
+
+// validateMessageUpdate checks a request replacing an existing message, normalizing its phone
+// number in place, and returns the new send time
+func validateMessageUpdate(req *ScheduleMessageRequest) (time.Time, *apiError) {
+	scheduledAt, apiErr := parseSendTime(req.ScheduledAt, req.Timezone)
+	if apiErr != nil {
+		return time.Time{}, apiErr
+	}
+	if apiErr := checkScheduleHorizon(scheduledAt); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+
+	phone, err := normalizePhoneNumber(req.PhoneNumber)
+	if err != nil {
+		return time.Time{}, &apiError{Code: codeInvalidPhoneNumber, Message: err.Error()}
+	}
+	req.PhoneNumber = phone
+
+	if len(req.Variants) > 0 {
+		return time.Time{}, &apiError{Code: codeInvalidParameter, Message: "variants can only be given when scheduling"}
+	}
+	if _, apiErr := validateContentTemplate(req); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+	if _, apiErr := validateTwilioParams(req.TwilioParams); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+	if _, apiErr := validateSendWindow(req.SendWindow, req.Timezone); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+	if term, blocked := findBlockedTerm(req.Content); blocked {
+		return time.Time{}, blockedContentError(term)
+	}
+	if apiErr := validateVariablesURL(req.VariablesURL); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+	if _, apiErr := parseMaxStaleness(req.MaxStaleness); apiErr != nil {
+		return time.Time{}, apiErr
+	}
+	return scheduledAt, nil
+}
+
+// applyMessageUpdate replaces an editable message's content and send time with a request already
+// checked by validateMessageUpdate. Under APPROVAL_REQUIRED an edited message needs approving again.
+func applyMessageUpdate(message *Message, req ScheduleMessageRequest, scheduledAt time.Time) {
 	message.PhoneNumber = req.PhoneNumber
+	if req.Content != message.Content {
+		message.Variant = "" // edited copy no longer belongs to its A/B variant
+	}
 	message.Content = req.Content
+	message.ContentSID = req.ContentSID
+	message.ContentVariables, _ = validateContentTemplate(&req)
+	message.TwilioParams, _ = validateTwilioParams(req.TwilioParams)
+	message.SendWindow, _ = validateSendWindow(req.SendWindow, req.Timezone)
+	message.SkipFooter = req.SkipFooter
+	message.VariablesURL = req.VariablesURL
+	message.MaxStaleness, _ = parseMaxStaleness(req.MaxStaleness)
+	message.Segments = 0
+	if message.ContentSID == "" {
+		message.Segments, _ = countSegments(renderContent(*message))
+	}
 	message.ScheduledAt = scheduledAt
-	message.UpdatedAt = time.Now()
-
-	db.Save(&message)
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Message updated successfully",
-		"data":    message,
-	})
+	message.AttemptCount = 0
+	message.NextAttemptAt = nil
+	message.UpdatedAt = time.Now().UTC()
+	if message.Status == "pending" && approvalRequired {
+		message.Status = "pending_approval"
+		message.ReviewedBy = ""
+		message.ReviewedAt = nil
+		message.StatusUpdatedAt = &message.UpdatedAt
+	}
 }
 
 func deleteMessage(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidMessageID, "Invalid message ID")
 		return
 	}
 
-	result := db.Delete(&Message{}, uint(id))
+	result := db.Scopes(forTenant(c)).Delete(&Message{}, uint(id))
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message"})
+		respondError(c, http.StatusInternalServerError, "Failed to delete message")
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		respondErrorCode(c, http.StatusNotFound, codeMessageNotFound, "Message not found")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Message deleted successfully",
-	})
+	respond(c, http.StatusOK, gin.H{"id": uint(id)})
 }
 
-
 // handleMessageStatus receives status updates from Twilio
 func handleMessageStatus(c *gin.Context) {
-    var status struct {
-        MessageSID string `form:"MessageSid"`
-        Status     string `form:"MessageStatus"`
-        To         string `form:"To"`
-    }
+	status, err := bindStatusCallback(c)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+		return
+	}
+	// Acknowledge unknown statuses so Twilio does not retry them, but never persist them
+	if !twilioCallbackStatuses[status.Status] {
+		log.Printf("Ignoring status callback with unknown MessageStatus %q (MessageSid %s)", status.Status, status.MessageSID)
+		respond(c, http.StatusOK, gin.H{"updated": 0, "ignored": true})
+		return
+	}
 
-    if err := c.ShouldBind(&status); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-        return
-    }
+	// Under a delivery burst callbacks are acknowledged at once and written in batches
+	if statusBatcher != nil {
+		statusBatcher.add(status)
+		respond(c, http.StatusOK, gin.H{"queued": true})
+		return
+	}
 
-    // Update your database with the delivery status
-    result := db.Model(&Message{}).Where("phone_number = ?", status.To).Updates(map[string]interface{}{
-        "status":     status.Status,
-        "updated_at": time.Now(),
-    })
+	updated, err := applyStatusCallbacks([]statusCallback{status})
+	if err != nil {
+		log.Printf("Failed to update message status: %v", err)
+		respondError(c, http.StatusInternalServerError, "Failed to update status")
+		return
+	}
 
-    if result.Error != nil {
-        log.Printf("Failed to update message status: %v", result.Error)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update status"})
-        return
-    }
+	respond(c, http.StatusOK, gin.H{"updated": updated})
+}
 
-    c.Status(http.StatusOK)
+// callbackTargets selects the message a status callback is about: the one Twilio accepted under
+// its MessageSid. Callbacks forwarded without a SID fall back to the recipient, limited to
+// messages Twilio has already accepted so nothing still queued here is marked as sent.
+func callbackTargets(tx *gorm.DB, status statusCallback) *gorm.DB {
+	if status.MessageSID != "" {
+		return tx.Where("twilio_sid = ?", status.MessageSID)
+	}
+	return tx.Where("phone_number = ? AND twilio_sid <> '' AND status IN ?", status.To, []string{"queued", "sending", "sent", "delivered"})
 }
 
-// messageProcessor runs in background to check for messages to send
+// applyStatusCallbacks applies callbacks in order in one transaction and returns how many
+// message updates they made. Late callbacks that would move a message backwards (e.g. a "sent"
+// arriving after "delivered") are ignored. Status changes are published once committed.
+func applyStatusCallbacks(callbacks []statusCallback) (int, error) {
+	type change struct {
+		message  Message
+		previous string
+	}
+	var changes []change
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		for _, status := range callbacks {
+			var affected []Message
+			if err := callbackTargets(tx, status).Find(&affected).Error; err != nil {
+				return err
+			}
+			for _, message := range affected {
+				if !isStatusAdvance(message.Status, status.Status) {
+					continue
+				}
+				updates := map[string]interface{}{
+					"status":            status.Status,
+					"status_updated_at": now,
+					"updated_at":        now,
+				}
+				if status.Status == "delivered" {
+					updates["delivered_at"] = now
+				}
+				if status.ErrorCode != 0 {
+					updates["error_code"] = status.ErrorCode
+				}
+				result := tx.Model(&Message{}).Where("id = ?", message.ID).Updates(updates)
+				if result.Error != nil {
+					return result.Error
+				}
+				previous := message.Status
+				message.Status = status.Status
+				changes = append(changes, change{message: message, previous: previous})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, change := range changes {
+		publishStatusChange(change.message, change.previous)
+	}
+	return len(changes), nil
+}
+
+// processorInterval is how often messageProcessor looks for due messages, from PROCESSOR_INTERVAL
+var processorInterval time.Duration
+
+// processorStartedAt anchors the processor's ticks, which fall every processorInterval after it
+var processorStartedAt time.Time
+
+// processorLastRun is the UnixNano time the last processor tick finished without panicking
+var processorLastRun atomic.Int64
+
+// processorHeartbeat is the UnixNano time the processor last showed progress: a tick starting or
+// a message being worked. A long pass keeps it fresh, so only a stuck loop goes stale.
+var processorHeartbeat atomic.Int64
+
+// processorPanics counts ticks that panicked and were recovered
+var processorPanics atomic.Int64
+
+// processorRun is held for the duration of a processing pass, so a ticker run and
+// POST /admin/process-now never work the same batch at once
+var processorRun sync.Mutex
+
+// messageProcessor runs sendDueMessages every processorInterval. A panicking tick is recovered
+// and logged; should the loop itself die, it is restarted.
 func messageProcessor() {
-	ticker := time.NewTicker(30 * time.Second) // Check every 30 seconds
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ALERT: message processor died: %v; restarting\n%s", r, debug.Stack())
+			go messageProcessor()
+		}
+	}()
+
+	ticker := time.NewTicker(processorInterval)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		sendDueMessages()
-	}
-}
-
-func sendDueMessages() {
-    var messages []Message
-    now := time.Now()
-    
-    result := db.Where("status = ? AND scheduled_at <= ?", "pending", now).Find(&messages)
-    if result.Error != nil {
-        log.Printf("Error fetching due messages: %v", result.Error)
-        return
-    }
-
-    // Rate limit to 1 message per second
-    limiter := time.Tick(1 * time.Second)
-    
-    for _, message := range messages {
-        <-limiter // Wait for the rate limiter
-        success := sendMessage(message)
-        
-        if success {
-            message.Status = "sent"
-        } else {
-            message.Status = "failed"
-        }
-        
-        message.UpdatedAt = time.Now()
-        db.Save(&message)
-    }
-}
-
-func sendMessage(message Message) bool {
-    maxRetries := 3
-    retryDelay := 2 * time.Second
-
-    params := &api.CreateMessageParams{}
-    params.SetTo(message.PhoneNumber)
-    params.SetFrom(twilioConfig.FromNumber)
-    params.SetBody(message.Content)
-
-    for i := 0; i < maxRetries; i++ {
-        resp, err := twilioClient.Api.CreateMessage(params)
-        if err == nil && resp.Sid != nil {
-            log.Printf("Message sent successfully to %s. SID: %s", message.PhoneNumber, *resp.Sid)
-            return true
-        }
-
-        if i < maxRetries-1 {
-            log.Printf("Attempt %d failed for %s: %v. Retrying...", i+1, message.PhoneNumber, err)
-            time.Sleep(retryDelay)
-        }
-    }
-
-    log.Printf("Failed to send message to %s after %d attempts", message.PhoneNumber, maxRetries)
-    return false
-}
\ No newline at end of file
+		runProcessorTick()
+	}
+}
+
+func runProcessorTick() {
+	defer func() {
+		if r := recover(); r != nil {
+			processorPanics.Add(1)
+			log.Printf("ALERT: message processor tick panicked: %v\n%s", r, debug.Stack())
+		}
+	}()
+	processorHeartbeat.Store(time.Now().UnixNano())
+
+	// A manual pass is already working the queue; the tick still counts as a sign of life
+	if processorRun.TryLock() {
+		defer processorRun.Unlock()
+		sendDueMessages(0)
+	}
+	processorLastRun.Store(time.Now().UnixNano())
+}
+
+// processorHealth describes the processor loop for /healthz. It is stale when the loop has shown
+// no progress for three intervals, e.g. because a tick is stuck; a long pass over a big backlog
+// records a heartbeat per message and stays healthy.
+func processorHealth() (gin.H, bool) {
+	last := processorStartedAt
+	health := gin.H{"interval": processorInterval.String(), "panics": processorPanics.Load()}
+	if nanos := processorLastRun.Load(); nanos != 0 {
+		health["last_run_at"] = time.Unix(0, nanos).UTC()
+	}
+	if nanos := processorHeartbeat.Load(); nanos != 0 {
+		last = time.Unix(0, nanos).UTC()
+		health["last_heartbeat_at"] = last
+	}
+	stale := time.Since(last) > 3*processorInterval
+	health["stale"] = stale
+	return health, stale
+}
+
+// estimatedSendAt rounds scheduledAt up to the processor tick that will pick the message up,
+// ignoring rate limiting and any backlog ahead of it
+func estimatedSendAt(scheduledAt time.Time) time.Time {
+	elapsed := scheduledAt.Sub(processorStartedAt)
+	if elapsed <= 0 {
+		return processorStartedAt.Add(processorInterval)
+	}
+	ticks := (elapsed + processorInterval - 1) / processorInterval
+	return processorStartedAt.Add(ticks * processorInterval)
+}
+
+// dueMessages selects the pending messages due at now. Times are compared as SQLite text, which
+// is only correct because every stored time is UTC (see normalizeStoredTimes).
+func dueMessages(now time.Time) *gorm.DB {
+	return db.Where("status = ? AND scheduled_at <= ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", "pending", now, now)
+}
+
+// sendDueMessages works through the due pending messages, at most limit of them when limit is
+// positive, and returns the messages it processed in their final state. Callers hold processorRun.
+func sendDueMessages(limit int) []*Message {
+	if sendingPaused.Load() {
+		return nil
+	}
+
+	var messages []Message
+	now := time.Now().UTC()
+
+	query := dueMessages(now)
+	if limit > 0 {
+		query = query.Order("scheduled_at ASC").Limit(limit)
+	}
+	if err := query.Find(&messages).Error; err != nil {
+		log.Printf("Error fetching due messages: %v", err)
+		return nil
+	}
+
+	var processed []*Message
+	lastSent := make(map[string]time.Time) // recipients messaged during this pass
+
+	// Rate limit to 1 message per second
+	limiter := time.Tick(1 * time.Second)
+
+	for _, message := range messages {
+		processorHeartbeat.Store(time.Now().UnixNano())
+
+		// Outside its send window a message waits for the next opening without taking a send
+		// slot, unless that opening is past its deadline and it is claimed below to expire
+		opens, held := nextSendWindowOpening(message, now)
+		if held && !sendWindowMissesDeadline(message, opens) {
+			deferToSendWindow(&message, opens)
+			continue
+		}
+
+		if opens, blocked := recipientGapOpens(message, lastSent, time.Now().UTC()); blocked {
+			deferForRecipientGap(&message, opens)
+			continue
+		}
+
+		<-limiter // Wait for the rate limiter
+		if sendingPaused.Load() {
+			return processed
+		}
+		// Cancelled or claimed by another instance since the batch was loaded
+		previousStatus := message.Status
+		if !claimMessage(&message) {
+			continue
+		}
+		// The claim reloaded the message; an edit since the batch was loaded may have moved it
+		// later or into a closed send window
+		claimedAt := time.Now().UTC()
+		if message.ScheduledAt.After(claimedAt) || (message.NextAttemptAt != nil && message.NextAttemptAt.After(claimedAt)) {
+			releaseClaim(&message)
+			continue
+		}
+		opens, held = nextSendWindowOpening(message, claimedAt)
+		if held && !sendWindowMissesDeadline(message, opens) {
+			releaseClaim(&message)
+			deferToSendWindow(&message, opens)
+			continue
+		}
+		processed = append(processed, &message)
+
+		// A pending message that already has a SID was accepted by Twilio but its sent status
+		// was never saved; finish the bookkeeping instead of sending it a second time
+		if message.TwilioSID != "" {
+			log.Printf("Message %d is pending but Twilio already accepted it as %s; marking sent without resending", message.ID, message.TwilioSID)
+			sentAt := time.Now().UTC()
+			message.Status = "sent"
+			message.SentAt = &sentAt
+			message.NextAttemptAt = nil
+			saveProcessedMessage(&message, previousStatus)
+			continue
+		}
+
+		// Time-critical messages held up by an outage or backlog are dropped rather than sent late
+		if message.MaxStaleness > 0 {
+			if late := time.Since(message.ScheduledAt); late > time.Duration(message.MaxStaleness)*time.Second {
+				log.Printf("Message %d expired unsent, %s past its scheduled time", message.ID, late.Round(time.Second))
+				message.Status = "expired"
+				message.LastError = fmt.Sprintf("expired %s after scheduled_at (max_staleness %ds)", late.Round(time.Second), message.MaxStaleness)
+				saveProcessedMessage(&message, previousStatus)
+				continue
+			}
+		}
+		if held {
+			log.Printf("Message %d expired unsent outside its send window", message.ID)
+			message.Status = "expired"
+			message.LastError = sendWindowExpiry(message, opens)
+			saveProcessedMessage(&message, previousStatus)
+			continue
+		}
+
+		// A failed lookup is the variables source's fault, not Twilio's, so it is not
+		// retried and leaves the breaker alone
+		if err := resolveMessageVariables(&message); err != nil {
+			log.Printf("Message %d failed before sending: %v", message.ID, err)
+			message.Status = "failed"
+			message.LastError = err.Error()
+			saveProcessedMessage(&message, previousStatus)
+			continue
+		}
+
+		proceed, err := runPreSendHooks(&message)
+		if err != nil || !proceed {
+			if err != nil {
+				log.Printf("Pre-send hook failed message %d: %v", message.ID, err)
+				message.Status = "failed"
+				message.LastError = "pre-send hook: " + err.Error()
+			} else {
+				log.Printf("Pre-send hook skipped message %d", message.ID)
+				message.Status = "skipped"
+			}
+			saveProcessedMessage(&message, previousStatus)
+			continue
+		}
+
+		// Checked last so that an Allow granting the half-open probe is always followed by a
+		// send and a recorded outcome. While the circuit is open the rest of the batch stays
+		// pending for a later tick.
+		if !twilioBreaker.Allow() {
+			releaseClaim(&message)
+			return processed[:len(processed)-1]
+		}
+		err = sendMessage(&message)
+		message.AttemptCount++
+		sendAlerts.record(err != nil)
+		if err != nil && isTransientError(err) {
+			twilioBreaker.RecordFailure()
+		} else {
+			twilioBreaker.RecordSuccess()
+		}
+
+		if err == nil {
+			// Record the SID on its own first, so a row whose full save fails below is
+			// recognised as sent on the next tick instead of being sent again
+			if message.TwilioSID != "" {
+				sid := message.TwilioSID
+				if err := withDBRetry(func() error {
+					return db.Model(&Message{}).Where("id = ?", message.ID).UpdateColumn("twilio_sid", sid).Error
+				}); err != nil {
+					log.Printf("ALERT: message %d was sent as %s but its SID could not be saved: %v", message.ID, sid, err)
+				}
+			}
+
+			sentAt := time.Now().UTC()
+			message.Status = "sent"
+			message.SentAt = &sentAt
+			message.NextAttemptAt = nil
+			lastSent[message.PhoneNumber] = sentAt
+			message.LastError = ""
+			message.ErrorCode = 0
+		} else {
+			message.LastError = err.Error()
+			message.ErrorCode = twilioErrorCode(err)
+			if isTransientError(err) && message.AttemptCount < retryConfig.MaxAttempts {
+				next := time.Now().UTC().Add(retryBackoff(message.AttemptCount))
+				message.Status = "pending"
+				message.NextAttemptAt = &next
+				log.Printf("Re-queued message %d for %s (attempt %d of %d)", message.ID, next.Format(time.RFC3339), message.AttemptCount, retryConfig.MaxAttempts)
+			} else {
+				message.Status = "failed"
+			}
+		}
+
+		saveProcessedMessage(&message, previousStatus)
+	}
+	return processed
+}
+
+// saveProcessedMessage persists the outcome of a processing attempt and announces status changes
+func saveProcessedMessage(message *Message, previousStatus string) {
+	message.UpdatedAt = time.Now().UTC()
+	if message.Status != previousStatus {
+		message.StatusUpdatedAt = &message.UpdatedAt
+	}
+	if err := withDBRetry(func() error { return db.Save(message).Error }); err != nil {
+		log.Printf("ALERT: failed to save message %d as %s (SID %q); reconcile it by hand: %v",
+			message.ID, message.Status, message.TwilioSID, err)
+	}
+
+	if message.Status != previousStatus {
+		publishStatusChange(*message, previousStatus)
+	}
+}
+
+// twilioErrorCode extracts the Twilio error code from a failed API call, 0 when there is none
+func twilioErrorCode(err error) int {
+	var restErr *client.TwilioRestError
+	if errors.As(err, &restErr) {
+		return restErr.Code
+	}
+	return 0
+}
+
+// withDBRetry runs a write, retrying with backoff while it fails, e.g. on a busy SQLite database
+func withDBRetry(write func() error) error {
+	delay := 200 * time.Millisecond
+	var err error
+	for attempt := 1; attempt <= 5; attempt++ {
+		if err = write(); err == nil {
+			return nil
+		}
+		if attempt < 5 {
+			log.Printf("Database write failed (attempt %d): %v. Retrying in %s...", attempt, err, delay)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
+
+// retryBackoff returns the delay before the next attempt after the given number of failed attempts
+func retryBackoff(attempts int) time.Duration {
+	delay := retryConfig.BaseDelay
+	for i := 1; i < attempts && delay < retryConfig.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryConfig.MaxDelay {
+		delay = retryConfig.MaxDelay
+	}
+	return delay
+}
+
+// isTransientError reports whether a send failure is worth retrying on a later tick.
+// Twilio 4xx responses (bad number, unverified sender, ...) will not succeed on retry,
+// while timeouts and other network errors usually will.
+func isTransientError(err error) bool {
+	var restErr *client.TwilioRestError
+	if errors.As(err, &restErr) {
+		return restErr.Status == http.StatusTooManyRequests || restErr.Status >= 500
+	}
+	if errors.Is(err, errUnknownAccount) || errors.Is(err, errInvalidTwilioParams) {
+		return false
+	}
+	// Anything else is a transport failure, including TWILIO_TIMEOUT expiring
+	return true
+}
+
+// messageFooter is appended to every message that does not opt out, from MESSAGE_FOOTER
+var messageFooter string
+
+// renderContent produces the final body sent to the recipient
+func renderContent(message Message) string {
+	body := message.Content
+	if body == "" && message.MediaKey != "" {
+		body = defaultMMSBody
+	}
+	if message.variables != nil {
+		body = expandVariables(body, message.variables)
+	}
+	if messageFooter != "" && !message.SkipFooter {
+		if body != "" {
+			body += "\n"
+		}
+		body += messageFooter
+	}
+	return body
+}
+
+// sendMessage delivers message through Twilio, recording the rendered body on it
+func sendMessage(message *Message) error {
+	maxRetries := 3
+	retryDelay := 2 * time.Second
+
+	if message.ContentSID == "" {
+		message.RenderedContent = renderContent(*message)
+		message.Segments, _ = countSegments(message.RenderedContent)
+		if withoutFooter, _ := countSegments(message.Content); message.Segments > withoutFooter {
+			log.Printf("Footer grows message %d from %d to %d segments", message.ID, withoutFooter, message.Segments)
+		}
+	}
+
+	if dryRun {
+		return recordDryRunSend(message)
+	}
+
+	var mediaURL string
+	if message.MediaKey != "" {
+		if privateMedia == nil {
+			return errors.New("message has media but MEDIA_STORE is not configured")
+		}
+		link, err := privateMedia.SignedURL(message.MediaKey, mediaURLTTL)
+		if err != nil {
+			return fmt.Errorf("sign media URL: %w", err)
+		}
+		mediaURL = link
+	}
+
+	// The message's own account is tried first; a retryable failure moves on to the next
+	// account of TWILIO_FALLBACK_ACCOUNTS, while a permanent one would fail on any account
+	var err error
+	for _, account := range sendChain(*message) {
+		config, restClient, accountErr := accountNamed(account)
+		if accountErr != nil {
+			return accountErr
+		}
+		params, paramsErr := createMessageParams(message, config, mediaURL)
+		if paramsErr != nil {
+			return paramsErr
+		}
+
+		var sid string
+		if sid, err = createWithRetries(message, restClient, params, maxRetries, retryDelay); err == nil {
+			message.TwilioSID = sid
+			message.SentVia = account
+			return nil
+		}
+		if !isTransientError(err) {
+			break
+		}
+		log.Printf("Twilio account %s failed for message %d: %v", account, message.ID, err)
+	}
+
+	log.Printf("Failed to send message to %s: %v", message.PhoneNumber, err)
+	return err
+}
+
+// createMessageParams builds the Twilio request for a message sent through config's account
+func createMessageParams(message *Message, config TwilioConfig, mediaURL string) (*api.CreateMessageParams, error) {
+	params := &api.CreateMessageParams{}
+	params.SetTo(message.PhoneNumber)
+	if config.MessagingService != "" {
+		params.SetMessagingServiceSid(config.MessagingService)
+	} else {
+		params.SetFrom(config.FromNumber)
+	}
+	// Templates are rendered by Twilio from the approved content, so no body is sent
+	if message.ContentSID != "" {
+		params.SetContentSid(message.ContentSID)
+		if message.ContentVariables != "" {
+			params.SetContentVariables(message.ContentVariables)
+		}
+	} else {
+		params.SetBody(message.RenderedContent)
+	}
+	if mediaURL != "" {
+		params.SetMediaUrl([]string{mediaURL})
+	}
+	if config.StatusCallbackURL != "" {
+		params.SetStatusCallback(config.StatusCallbackURL)
+	}
+	if err := applyTwilioParams(params, message.TwilioParams); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// createWithRetries calls Twilio up to maxRetries times while failures are transient,
+// returning the SID Twilio assigned
+func createWithRetries(message *Message, restClient *twilio.RestClient, params *api.CreateMessageParams, maxRetries int, retryDelay time.Duration) (string, error) {
+	var err error
+	for i := 0; i < maxRetries; i++ {
+		var resp *api.ApiV2010Message
+		resp, err = restClient.Api.CreateMessage(params)
+		if err == nil && resp.Sid != nil {
+			log.Printf("Message sent successfully to %s. SID: %s", message.PhoneNumber, *resp.Sid)
+			applyTwilioPrice(message, resp) // rarely known yet; the price poller fills it in later
+			return *resp.Sid, nil
+		}
+		if err == nil {
+			err = errors.New("twilio returned no message SID")
+		}
+		if !isTransientError(err) {
+			break
+		}
+
+		if i < maxRetries-1 {
+			log.Printf("Attempt %d failed for %s: %v. Retrying...", i+1, message.PhoneNumber, err)
+			time.Sleep(retryDelay)
+		}
+	}
+	return "", err
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// useTestDB points the package database at a fresh, migrated SQLite file for one test
+func useTestDB(t *testing.T) {
+	t.Helper()
+	conn, err := openDB(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := db
+	db = conn
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+		db = previous
+	})
+}
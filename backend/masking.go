@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maskPhoneNumbers hides recipient numbers in API responses, from MASK_PHONE_NUMBERS.
+// Numbers are still stored and sent in full.
+var maskPhoneNumbers bool
+
+// maskPhoneNumber keeps the leading "+" and digit and the last four digits, e.g. +1••••••1234
+func maskPhoneNumber(phone string) string {
+	runes := []rune(phone)
+	if len(runes) <= 6 {
+		return strings.Repeat("•", len(runes))
+	}
+	return string(runes[:2]) + strings.Repeat("•", len(runes)-6) + string(runes[len(runes)-4:])
+}
+
+// maskResponseData masks every phone_number field in a response payload, however deeply nested.
+// Top-level json.RawMessage values of a gin.H are passed through untouched, since they may be
+// signed bytes (see getMessageReceipt) that must not be re-encoded.
+func maskResponseData(data interface{}) interface{} {
+	if h, ok := data.(gin.H); ok {
+		masked := make(gin.H, len(h))
+		for key, value := range h {
+			if raw, isRaw := value.(json.RawMessage); isRaw {
+				masked[key] = raw
+				continue
+			}
+			if phone, isString := value.(string); isString && key == "phone_number" && phone != "" {
+				masked[key] = maskPhoneNumber(phone)
+				continue
+			}
+			masked[key] = maskResponseData(value)
+		}
+		return masked
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return data
+	}
+	return maskGeneric(generic)
+}
+
+func maskGeneric(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if phone, ok := field.(string); ok && key == "phone_number" && phone != "" {
+				v[key] = maskPhoneNumber(phone)
+				continue
+			}
+			v[key] = maskGeneric(field)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = maskGeneric(item)
+		}
+	}
+	return value
+}
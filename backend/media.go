@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mediaStore turns the storage key of a private media file into a URL Twilio can fetch
+type mediaStore interface {
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// privateMedia is the configured media backend, nil unless MEDIA_STORE is set
+var privateMedia mediaStore
+
+// defaultMMSBody is sent as the body of a media message scheduled without content, from
+// DEFAULT_MMS_BODY; some carriers reject MMS with an empty body. Empty sends no body.
+var defaultMMSBody string
+
+// mediaURLTTL is how long a signed media URL stays valid, from MEDIA_URL_TTL. Twilio fetches
+// media when it handles the message, which can lag the API call while the send queues.
+var mediaURLTTL time.Duration
+
+// loadMediaStore configures private media from MEDIA_STORE: s3 presigns GET URLs for a bucket,
+// file serves MEDIA_DIR through GET /media/* behind an HMAC-signed expiring link
+func loadMediaStore() {
+	mediaURLTTL = getEnvDuration("MEDIA_URL_TTL", 4*time.Hour)
+	defaultMMSBody = os.Getenv("DEFAULT_MMS_BODY")
+	if mediaURLTTL < 5*time.Minute {
+		log.Fatal("MEDIA_URL_TTL must be at least 5m so Twilio can fetch the media")
+	}
+
+	switch kind := os.Getenv("MEDIA_STORE"); kind {
+	case "":
+	case "s3":
+		bucket, err := loadS3Bucket("MEDIA")
+		if err != nil {
+			log.Fatal("Invalid S3 media configuration: ", err)
+		}
+		privateMedia = s3MediaStore{bucket}
+	case "file":
+		store := fileMediaStore{
+			dir:       getEnvString("MEDIA_DIR", "media"),
+			publicURL: strings.TrimRight(os.Getenv("MEDIA_PUBLIC_URL"), "/"),
+			secret:    os.Getenv("MEDIA_SIGNING_SECRET"),
+		}
+		if store.publicURL == "" || store.secret == "" {
+			log.Fatal("MEDIA_STORE=file needs MEDIA_PUBLIC_URL and MEDIA_SIGNING_SECRET")
+		}
+		privateMedia = store
+	default:
+		log.Fatalf("Unknown MEDIA_STORE %q; use s3 or file", kind)
+	}
+}
+
+// validateMediaKey checks an optional media key on a schedule request
+func validateMediaKey(key string) *apiError {
+	if key == "" {
+		return nil
+	}
+	if privateMedia == nil {
+		return &apiError{Code: codeNotConfigured, Message: "media_key requires MEDIA_STORE to be configured"}
+	}
+	if strings.HasPrefix(key, "/") || strings.Contains(key, "..") || strings.ContainsAny(key, "\\?#") {
+		return &apiError{Code: codeInvalidParameter, Message: "media_key must be a relative storage key such as promos/spring.jpg", Details: gin.H{"media_key": key}}
+	}
+	return nil
+}
+
+// s3MediaStore presigns path-style GET URLs (SigV4 query signing) for objects in a private bucket
+type s3MediaStore struct {
+	s3Bucket
+}
+
+func (s s3MediaStore) SignedURL(key string, ttl time.Duration) (string, error) {
+	target, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.accessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(min(ttl, 7*24*time.Hour)/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		target.EscapedPath(),
+		canonicalQuery,
+		"host:" + target.Host,
+		"",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	signature := hex.EncodeToString(hmacSHA256(s3SigningKey(s.secretKey, date, s.region), stringToSign))
+
+	target.RawQuery = canonicalQuery + "&X-Amz-Signature=" + signature
+	return target.String(), nil
+}
+
+// fileMediaStore serves files under dir from this service; links carry an expiry and an HMAC
+// of the key and expiry, so they cannot be altered or reused once expired
+type fileMediaStore struct {
+	dir       string
+	publicURL string
+	secret    string
+}
+
+func (s fileMediaStore) SignedURL(key string, ttl time.Duration) (string, error) {
+	if _, err := os.Stat(filepath.Join(s.dir, filepath.FromSlash(key))); err != nil {
+		return "", fmt.Errorf("media %s: %w", key, err)
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	link := s.publicURL + "/media/" + (&url.URL{Path: key}).EscapedPath()
+	return link + "?expires=" + expires + "&signature=" + s.signature(key, expires), nil
+}
+
+func (s fileMediaStore) signature(key, expires string) string {
+	return hex.EncodeToString(hmacSHA256([]byte(s.secret), key+"\n"+expires))
+}
+
+// serveSignedMedia serves a file-backed media link produced by fileMediaStore.SignedURL.
+// It is unauthenticated because Twilio fetches it; the signature is the credential.
+func serveSignedMedia(c *gin.Context) {
+	store, ok := privateMedia.(fileMediaStore)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	expires := c.Query("expires")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || validateMediaKey(key) != nil || time.Now().Unix() > unix ||
+		!hmac.Equal([]byte(c.Query("signature")), []byte(store.signature(key, expires))) {
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	c.File(filepath.Join(store.dir, filepath.FromSlash(key)))
+}
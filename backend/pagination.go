@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxPerPage caps per_page on paginated lists
+const maxPerPage = 500
+
+// pagination describes one page of a list, returned next to data in the envelope
+type pagination struct {
+	Page       int   `json:"page"`
+	PerPage    int   `json:"per_page"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// parsePagination reads the page and per_page query parameters. Lists stay unpaginated unless
+// one of them is given, so existing clients keep receiving every row.
+func parsePagination(c *gin.Context) (*pagination, bool) {
+	if c.Query("page") == "" && c.Query("per_page") == "" {
+		return nil, true
+	}
+
+	page := &pagination{Page: 1, PerPage: 50}
+	var err error
+	if raw := c.Query("page"); raw != "" {
+		if page.Page, err = strconv.Atoi(raw); err != nil || page.Page < 1 {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, "page must be a positive integer")
+			return nil, false
+		}
+	}
+	if raw := c.Query("per_page"); raw != "" {
+		if page.PerPage, err = strconv.Atoi(raw); err != nil || page.PerPage < 1 || page.PerPage > maxPerPage {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, fmt.Sprintf("per_page must be between 1 and %d", maxPerPage))
+			return nil, false
+		}
+	}
+	return page, true
+}
+
+// paginate counts the rows query matches into page and limits query to that page
+func paginate(query *gorm.DB, model interface{}, page *pagination) (*gorm.DB, error) {
+	if err := query.Session(&gorm.Session{}).Model(model).Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+	page.TotalPages = int((page.Total + int64(page.PerPage) - 1) / int64(page.PerPage))
+	return query.Limit(page.PerPage).Offset((page.Page - 1) * page.PerPage), nil
+}
+
+// respondPage writes a list envelope with its pagination, plus RFC 8288 Link headers
+// (first, prev, next, last) and X-Total-Count for generic clients
+func respondPage(c *gin.Context, data interface{}, page *pagination) {
+	if page == nil {
+		respond(c, http.StatusOK, data)
+		return
+	}
+
+	link := func(number int, rel string) string {
+		target := *c.Request.URL
+		query := target.Query()
+		query.Set("page", strconv.Itoa(number))
+		query.Set("per_page", strconv.Itoa(page.PerPage))
+		target.RawQuery = query.Encode()
+		return fmt.Sprintf(`<%s>; rel="%s"`, target.RequestURI(), rel)
+	}
+	last := max(page.TotalPages, 1)
+	links := []string{link(1, "first")}
+	if page.Page > 1 {
+		links = append(links, link(min(page.Page-1, last), "prev"))
+	}
+	if page.Page < last {
+		links = append(links, link(page.Page+1, "next"))
+	}
+	links = append(links, link(last, "last"))
+	c.Header("Link", strings.Join(links, ", "))
+	c.Header("X-Total-Count", strconv.FormatInt(page.Total, 10))
+
+	if maskPhoneNumbers {
+		data = maskResponseData(data)
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "data": data, "pagination": page})
+}
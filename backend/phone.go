@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var e164Pattern = regexp.MustCompile(`^\+[1-9]\d{7,14}$`)
+
+// phoneFormatting matches the separators people commonly type inside phone numbers
+var phoneFormatting = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+
+var errInvalidPhoneNumber = errors.New("Invalid phone number. Use E.164 format, e.g. +14155552671")
+
+var countryCodePattern = regexp.MustCompile(`^[1-9]\d{0,2}$`)
+
+// defaultCountryCode is prepended to numbers entered without one, from DEFAULT_COUNTRY_CODE
+var defaultCountryCode string
+
+// loadDefaultCountryCode reads DEFAULT_COUNTRY_CODE, accepting "91" or "+91"
+func loadDefaultCountryCode() {
+	code := strings.TrimPrefix(strings.TrimSpace(os.Getenv("DEFAULT_COUNTRY_CODE")), "+")
+	if code == "" {
+		return
+	}
+	if !countryCodePattern.MatchString(code) {
+		log.Fatalf("Invalid DEFAULT_COUNTRY_CODE %q. Use a 1-3 digit calling code such as 1 or 91", code)
+	}
+	defaultCountryCode = code
+}
+
+// normalizePhoneNumber strips formatting from raw and returns it in E.164 form.
+// Numbers with an explicit + or 00 international prefix keep their own country code;
+// bare national numbers get DEFAULT_COUNTRY_CODE when one is configured.
+func normalizePhoneNumber(raw string) (string, error) {
+	number := phoneFormatting.Replace(strings.TrimSpace(raw))
+	switch {
+	case strings.HasPrefix(number, "+"):
+	case strings.HasPrefix(number, "00"):
+		number = "+" + strings.TrimPrefix(number, "00")
+	case defaultCountryCode != "":
+		number = "+" + defaultCountryCode + number
+	}
+
+	if !e164Pattern.MatchString(number) {
+		return "", errInvalidPhoneNumber
+	}
+	return number, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	api "github.com/twilio/twilio-go/rest/api/v2010"
+	"gorm.io/gorm"
+)
+
+// priceBatchSize caps the messages one price poll fetches from Twilio
+const priceBatchSize = 100
+
+// applyTwilioPrice copies Twilio's price onto the message when it is known. Twilio reports
+// prices as negative strings such as "-0.00790"; the stored price is the positive cost.
+func applyTwilioPrice(message *Message, resp *api.ApiV2010Message) bool {
+	if resp == nil || resp.Price == nil || *resp.Price == "" {
+		return false
+	}
+	price, err := strconv.ParseFloat(*resp.Price, 64)
+	if err != nil {
+		log.Printf("Unparseable Twilio price %q for message %d: %v", *resp.Price, message.ID, err)
+		return false
+	}
+
+	price = math.Abs(price)
+	message.Price = &price
+	if resp.PriceUnit != nil {
+		message.PriceUnit = *resp.PriceUnit
+	}
+	return true
+}
+
+// startPricePoller fetches Twilio's price for sent messages that have none yet, every interval.
+// Prices usually appear only after delivery; messages older than maxAge stop being polled.
+// A zero interval disables polling.
+func startPricePoller(interval, maxAge time.Duration) {
+	if interval <= 0 || dryRun {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			pollMessagePrices(maxAge)
+		}
+	}()
+}
+
+func pollMessagePrices(maxAge time.Duration) {
+	var messages []Message
+	err := db.Where("twilio_sid <> '' AND (dry_run IS NULL OR dry_run = ?) AND price IS NULL AND status IN ? AND sent_at >= ?",
+		false, []string{"sent", "delivered", "undelivered", "failed"}, time.Now().UTC().Add(-maxAge)).
+		Order("sent_at ASC").
+		Limit(priceBatchSize).
+		Find(&messages).Error
+	if err != nil {
+		log.Printf("Failed to load messages awaiting a price: %v", err)
+		return
+	}
+
+	for _, message := range messages {
+		_, restClient, err := accountFor(&message)
+		if err != nil {
+			continue
+		}
+		resp, err := restClient.Api.FetchMessage(message.TwilioSID, &api.FetchMessageParams{})
+		if err != nil {
+			log.Printf("Failed to fetch price of message %d (SID %s): %v", message.ID, message.TwilioSID, err)
+			continue
+		}
+		if !applyTwilioPrice(&message, resp) {
+			continue
+		}
+		err = db.Model(&Message{}).Where("id = ?", message.ID).
+			UpdateColumns(map[string]interface{}{"price": message.Price, "price_unit": message.PriceUnit}).Error
+		if err != nil {
+			log.Printf("Failed to save price of message %d: %v", message.ID, err)
+		}
+	}
+}
+
+// currencyCost is the actual spend in one currency
+type currencyCost struct {
+	Currency string  `json:"currency"`
+	Total    float64 `json:"total"`
+	Messages int64   `json:"messages"`
+}
+
+// costRollup totals the Twilio prices of the messages the query selects, per currency.
+// unpriced counts sent messages whose price Twilio has not reported yet.
+func costRollup(query *gorm.DB) (gin.H, error) {
+	costs := []currencyCost{}
+	err := query.Session(&gorm.Session{}).Model(&Message{}).
+		Select("price_unit AS currency, SUM(price) AS total, COUNT(*) AS messages").
+		Where("price IS NOT NULL").
+		Group("price_unit").
+		Order("price_unit ASC").
+		Scan(&costs).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range costs {
+		costs[i].Total = math.Round(costs[i].Total*100000) / 100000
+	}
+
+	var unpriced int64
+	err = query.Session(&gorm.Session{}).Model(&Message{}).
+		Where("price IS NULL AND twilio_sid <> '' AND (dry_run IS NULL OR dry_run = ?)", false).
+		Count(&unpriced).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"costs": costs, "unpriced": unpriced}, nil
+}
+
+// getCostReport rolls up actual Twilio spend of messages sent in the range, optionally per campaign
+func getCostReport(c *gin.Context) {
+	from, to, ok := parseReportRange(c)
+	if !ok {
+		return
+	}
+
+	query := db.Scopes(forTenant(c)).Where("sent_at >= ? AND sent_at < ?", from, to)
+	if campaignID := c.Query("campaign_id"); campaignID != "" {
+		query = query.Where("campaign_id = ?", campaignID)
+	}
+	cost, err := costRollup(query)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to build cost report")
+		return
+	}
+
+	cost["from"] = from
+	cost["to"] = to
+	respond(c, http.StatusOK, cost)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxProgressBuckets caps the points of one progress series
+const maxProgressBuckets = 1000
+
+// StatusChange is one recorded status transition of a message, kept for progress history
+type StatusChange struct {
+	ID             uint      `gorm:"primaryKey"`
+	MessageID      uint      `gorm:"not null;index"`
+	CampaignID     *uint     `gorm:"index"`
+	Status         string    `gorm:"not null"`
+	PreviousStatus string    `gorm:"not null"`
+	OccurredAt     time.Time `gorm:"not null"`
+}
+
+// recordStatusChange stores a transition in the status history. It is best effort: a failed
+// write is logged and the transition itself stands.
+func recordStatusChange(message Message, previousStatus string, at time.Time) {
+	change := StatusChange{
+		MessageID:      message.ID,
+		CampaignID:     message.CampaignID,
+		Status:         message.Status,
+		PreviousStatus: previousStatus,
+		OccurredAt:     at,
+	}
+	if err := db.Create(&change).Error; err != nil {
+		log.Printf("Failed to record status change of message %d to %s: %v", message.ID, message.Status, err)
+	}
+}
+
+// recordStatusChanges stores the transitions of messages moved to status by one bulk update,
+// inside its transaction so the history matches what was changed. Each message carries its
+// previous status; announce them with publishStatusEvents once the transaction commits.
+func recordStatusChanges(tx *gorm.DB, messages []Message, status string, at time.Time) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	changes := make([]StatusChange, 0, len(messages))
+	for _, message := range messages {
+		changes = append(changes, StatusChange{MessageID: message.ID, CampaignID: message.CampaignID, Status: status, PreviousStatus: message.Status, OccurredAt: at})
+	}
+	return tx.Create(&changes).Error
+}
+
+// progressGroups folds message statuses into the series of the campaign progress report
+var progressGroups = map[string]string{
+	"draft":            "pending",
+	"pending_approval": "pending",
+	"pending":          "pending",
+	"processing":       "pending",
+	"queued":           "sent",
+	"sending":          "sent",
+	"accepted":         "sent",
+	"sent":             "sent",
+	"delivered":        "delivered",
+	"undelivered":      "failed",
+	"failed":           "failed",
+	"cancelled":        "cancelled",
+}
+
+// progressPoint is a campaign's message counts per status group at one bucket boundary
+type progressPoint struct {
+	At        time.Time `json:"at"`
+	Pending   int       `json:"pending"`
+	Sent      int       `json:"sent"` // accepted by Twilio, no receipt yet
+	Delivered int       `json:"delivered"`
+	Failed    int       `json:"failed"`
+	Cancelled int       `json:"cancelled"`
+	Other     int       `json:"other"` // expired, skipped, rejected
+}
+
+// getCampaignProgress replays a campaign's status history into counts at every bucket boundary
+// from its creation (or from) until now (or to). Messages older than the history take their
+// current status from the time it was last updated.
+func getCampaignProgress(c *gin.Context) {
+	campaign, ok := findCampaign(c)
+	if !ok {
+		return
+	}
+
+	bucket, err := time.ParseDuration(c.DefaultQuery("bucket", "5m"))
+	if err != nil || bucket < time.Minute {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidDuration, "bucket must be a duration of at least 1m, such as 5m or 1h")
+		return
+	}
+	from := campaign.CreatedAt.UTC().Truncate(bucket)
+	to := time.Now().UTC()
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if raw := c.Query(bound.name); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				respondErrorCode(c, http.StatusBadRequest, codeInvalidDate, "Invalid "+bound.name+" date. Use ISO 8601 format.")
+				return
+			}
+			*bound.value = parsed.UTC()
+		}
+	}
+	if !from.Before(to) {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidDateRange, "from must be before to")
+		return
+	}
+	if buckets := to.Sub(from) / bucket; buckets > maxProgressBuckets {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, fmt.Sprintf("Range spans %d buckets; use a larger bucket (at most %d)", buckets, maxProgressBuckets))
+		return
+	}
+
+	var messages []Message
+	if err := db.Select("id, status, created_at, updated_at, status_updated_at").Where("campaign_id = ?", campaign.ID).Find(&messages).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to build campaign progress")
+		return
+	}
+	var changes []StatusChange
+	if err := db.Where("campaign_id = ? AND occurred_at <= ?", campaign.ID, to).Order("occurred_at ASC, id ASC").Find(&changes).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to build campaign progress")
+		return
+	}
+	history := make(map[uint][]StatusChange)
+	for _, change := range changes {
+		history[change.MessageID] = append(history[change.MessageID], change)
+	}
+
+	// Boundaries every bucket from from, plus to itself so the series ends on the current state
+	boundaries := []time.Time{}
+	for at := from; at.Before(to); at = at.Add(bucket) {
+		boundaries = append(boundaries, at)
+	}
+	boundaries = append(boundaries, to)
+
+	series := make([]progressPoint, 0, len(boundaries))
+	for _, at := range boundaries {
+		point := progressPoint{At: at}
+		for _, message := range messages {
+			if message.CreatedAt.After(at) {
+				continue
+			}
+			status := statusAt(message, history[message.ID], at)
+			switch progressGroups[status] {
+			case "pending":
+				point.Pending++
+			case "sent":
+				point.Sent++
+			case "delivered":
+				point.Delivered++
+			case "failed":
+				point.Failed++
+			case "cancelled":
+				point.Cancelled++
+			default:
+				point.Other++
+			}
+		}
+		series = append(series, point)
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"campaign_id": campaign.ID,
+		"bucket":      bucket.String(),
+		"series":      series,
+	})
+}
+
+// statusAt is the status a message had at the given time according to its sorted history
+func statusAt(message Message, changes []StatusChange, at time.Time) string {
+	if len(changes) > 0 {
+		i := sort.Search(len(changes), func(i int) bool { return changes[i].OccurredAt.After(at) })
+		if i > 0 {
+			return changes[i-1].Status
+		}
+		return changes[0].PreviousStatus
+	}
+
+	changedAt := message.UpdatedAt
+	if message.StatusUpdatedAt != nil {
+		changedAt = *message.StatusUpdatedAt
+	}
+	if changedAt.After(at) {
+		return "pending"
+	}
+	return message.Status
+}
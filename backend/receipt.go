@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// receiptSecret signs message receipts, from RECEIPT_SECRET; receipts are disabled without it
+var receiptSecret string
+
+// messageReceipt is the signed proof of a message's send and delivery handed to customers
+type messageReceipt struct {
+	MessageID       uint       `json:"message_id"`
+	PhoneNumber     string     `json:"phone_number"`
+	Content         string     `json:"content"`
+	TwilioSID       string     `json:"twilio_sid"`
+	Status          string     `json:"status"`
+	ScheduledAt     time.Time  `json:"scheduled_at"`
+	SentAt          *time.Time `json:"sent_at"`
+	DeliveredAt     *time.Time `json:"delivered_at"`
+	StatusUpdatedAt *time.Time `json:"status_updated_at"`
+	IssuedAt        time.Time  `json:"issued_at"`
+}
+
+// getMessageReceipt returns a receipt for one message with an HMAC-SHA256 signature over
+// its exact JSON encoding, so support can verify a shared receipt was not altered
+func getMessageReceipt(c *gin.Context) {
+	if receiptSecret == "" {
+		respondErrorCode(c, http.StatusServiceUnavailable, codeNotConfigured, "Receipts are not configured")
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidMessageID, "Invalid message ID")
+		return
+	}
+
+	var message Message
+	if err := db.Scopes(forTenant(c)).First(&message, uint(id)).Error; err != nil {
+		respondErrorCode(c, http.StatusNotFound, codeMessageNotFound, "Message not found")
+		return
+	}
+
+	content := message.RenderedContent
+	if content == "" {
+		content = message.Content
+	}
+	// Masked before signing: respond cannot mask the signed bytes afterwards
+	phone := message.PhoneNumber
+	if maskPhoneNumbers {
+		phone = maskPhoneNumber(phone)
+	}
+	receipt, err := json.Marshal(messageReceipt{
+		MessageID:       message.ID,
+		PhoneNumber:     phone,
+		Content:         content,
+		TwilioSID:       message.TwilioSID,
+		Status:          message.Status,
+		ScheduledAt:     message.ScheduledAt,
+		SentAt:          message.SentAt,
+		DeliveredAt:     message.DeliveredAt,
+		StatusUpdatedAt: message.StatusUpdatedAt,
+		IssuedAt:        time.Now().UTC(),
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to build receipt")
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"receipt":   json.RawMessage(receipt),
+		"signature": "sha256=" + signPayload(receiptSecret, receipt),
+	})
+}
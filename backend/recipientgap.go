@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// minInterMessageGap is the shortest time allowed between two sends to the same number, from
+// MIN_INTER_MESSAGE_GAP; 0 disables the throttle. A message due sooner is deferred, not dropped.
+var minInterMessageGap time.Duration
+
+// recipientGapOpens returns when the number may next be messaged if a send to it within
+// minInterMessageGap blocks this one; lastSent holds sends made earlier in the same pass
+func recipientGapOpens(message Message, lastSent map[string]time.Time, now time.Time) (time.Time, bool) {
+	if minInterMessageGap <= 0 {
+		return time.Time{}, false
+	}
+
+	latest, ok := lastSent[message.PhoneNumber]
+	var previous Message
+	result := db.Select("sent_at").
+		Where("phone_number = ? AND id <> ? AND sent_at >= ?", message.PhoneNumber, message.ID, now.Add(-minInterMessageGap)).
+		Order("sent_at DESC").
+		Limit(1).
+		Find(&previous)
+	if result.Error != nil {
+		log.Printf("Failed to check recent sends to message %d's recipient: %v", message.ID, result.Error)
+	} else if result.RowsAffected == 1 && previous.SentAt != nil && (!ok || previous.SentAt.After(latest)) {
+		latest, ok = *previous.SentAt, true
+	}
+	if !ok {
+		return time.Time{}, false
+	}
+
+	opens := latest.Add(minInterMessageGap)
+	return opens, opens.After(now)
+}
+
+// deferForRecipientGap requeues a pending message for when its recipient's gap has passed
+func deferForRecipientGap(message *Message, opens time.Time) {
+	err := db.Model(&Message{}).
+		Where("id = ? AND status = ?", message.ID, "pending").
+		UpdateColumn("next_attempt_at", opens).Error
+	if err != nil {
+		log.Printf("Failed to defer message %d for its recipient's send gap: %v", message.ID, err)
+		return
+	}
+	log.Printf("Message %d's recipient was messaged within MIN_INTER_MESSAGE_GAP; deferred to %s", message.ID, opens.Format(time.RFC3339))
+}
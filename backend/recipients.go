@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// getRecipientMessages returns every message sent to a phone number with a status summary
+func getRecipientMessages(c *gin.Context) {
+	phone, err := normalizePhoneNumber(c.Param("phone"))
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidPhoneNumber, err.Error())
+		return
+	}
+
+	var messages []Message
+	result := db.Scopes(forTenant(c)).
+		Where("phone_number = ?", phone).
+		Order("scheduled_at DESC").
+		Find(&messages)
+	if result.Error != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to fetch messages")
+		return
+	}
+
+	summary := gin.H{"total": len(messages), "sent": 0, "delivered": 0, "failed": 0}
+	for _, message := range messages {
+		if count, ok := summary[message.Status].(int); ok {
+			summary[message.Status] = count + 1
+		}
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"phone_number": phone,
+		"summary":      summary,
+		"messages":     messages,
+	})
+}
+
+// cancelRecipientPending cancels every queued message to a phone number, e.g. after an opt-out,
+// and stops the recurring messages to it so no further occurrences are created
+func cancelRecipientPending(c *gin.Context) {
+	phone, err := normalizePhoneNumber(c.Param("phone"))
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidPhoneNumber, err.Error())
+		return
+	}
+
+	var cancelled int64
+	var queued []Message
+	var recurringIDs []uint
+	now := time.Now().UTC()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id, campaign_id, phone_number, status").Scopes(forTenant(c)).Where("phone_number = ? AND status IN ?", phone, queuedStatuses).Find(&queued).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&Message{}).
+			Scopes(forTenant(c)).
+			Where("phone_number = ? AND status IN ?", phone, queuedStatuses).
+			Updates(map[string]interface{}{"status": "cancelled", "status_updated_at": now, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		cancelled = result.RowsAffected
+
+		if err := recordStatusChanges(tx, queued, "cancelled", now); err != nil {
+			return err
+		}
+
+		err := tx.Model(&RecurringMessage{}).Scopes(forTenant(c)).
+			Where("phone_number = ? AND active = ?", phone, true).
+			Pluck("id", &recurringIDs).Error
+		if err != nil {
+			return err
+		}
+		if len(recurringIDs) == 0 {
+			return nil
+		}
+		return tx.Model(&RecurringMessage{}).Where("id IN ?", recurringIDs).
+			Updates(map[string]interface{}{"active": false, "updated_at": now}).Error
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to cancel messages")
+		return
+	}
+
+	publishStatusEvents(queued, "cancelled", now)
+	for _, id := range recurringIDs {
+		unregisterRecurring(id)
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"phone_number":      phone,
+		"cancelled":         cancelled,
+		"stopped_recurring": len(recurringIDs),
+	})
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+)
+
+// recurrencePresets maps the friendly recurrence names accepted on the schedule request
+// to the cron expressions registered with the scheduler (server local time)
+var recurrencePresets = map[string]string{
+	"hourly":             "0 * * * *",
+	"daily_9am":          "0 9 * * *",
+	"weekdays_9am":       "0 9 * * 1-5",
+	"weekly_monday_9am":  "0 9 * * 1",
+	"first_of_month_9am": "0 9 1 * *",
+}
+
+// RecurringMessage is a message definition the scheduler turns into a pending Message on every fire
+type RecurringMessage struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	TenantID     string     `json:"-" gorm:"not null;default:'';index"`
+	CreatedBy    string     `json:"-"` // requestActor of the creating key, carried onto each occurrence for approval
+	PhoneNumber  string     `json:"phone_number" gorm:"not null"`
+	Category     string     `json:"category,omitempty"` // each occurrence's consent is checked against this category
+	Content      string     `json:"content" gorm:"not null"`
+	SkipFooter   bool       `json:"skip_footer"`
+	MediaKey     string     `json:"media_key,omitempty"`     // private media in MEDIA_STORE attached to each occurrence
+	VariablesURL string     `json:"variables_url,omitempty"` // send-time source of each occurrence's {{name}} variables
+	MaxStaleness int        `json:"max_staleness_seconds"`   // each occurrence expires instead of sending this late; 0 never expires
+	Account      string     `json:"account,omitempty"`       // named Twilio account each occurrence is sent through
+	Preset       string     `json:"preset" gorm:"not null"`
+	CronSpec     string     `json:"cron_spec" gorm:"not null"`
+	StartsAt     time.Time  `json:"starts_at" gorm:"not null"` // no occurrences are created before this
+	Active       bool       `json:"active" gorm:"not null;default:true"`
+	LastFiredAt  *time.Time `json:"last_fired_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// recurringEntries tracks the scheduler entry registered for each recurring message
+var recurringEntries = make(map[uint]cron.EntryID)
+var recurringEntriesMu sync.Mutex
+
+// presetNames lists the accepted recurrence presets, for error messages
+func presetNames() []string {
+	names := make([]string, 0, len(recurrencePresets))
+	for name := range recurrencePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// registerRecurringMessages schedules every active recurring message, e.g. after a restart
+func registerRecurringMessages() {
+	var recurring []RecurringMessage
+	if err := db.Where("active = ?", true).Find(&recurring).Error; err != nil {
+		log.Fatal("Failed to load recurring messages:", err)
+	}
+
+	for _, rec := range recurring {
+		if err := registerRecurring(rec); err != nil {
+			log.Printf("Failed to register recurring message %d: %v", rec.ID, err)
+		}
+	}
+}
+
+func registerRecurring(rec RecurringMessage) error {
+	id := rec.ID
+	entryID, err := scheduler.AddFunc(rec.CronSpec, func() { fireRecurring(id) })
+	if err != nil {
+		return err
+	}
+
+	recurringEntriesMu.Lock()
+	recurringEntries[id] = entryID
+	recurringEntriesMu.Unlock()
+	return nil
+}
+
+func unregisterRecurring(id uint) {
+	recurringEntriesMu.Lock()
+	defer recurringEntriesMu.Unlock()
+
+	if entryID, ok := recurringEntries[id]; ok {
+		scheduler.Remove(entryID)
+		delete(recurringEntries, id)
+	}
+}
+
+// fireRecurring creates the pending message for one occurrence of a recurring message.
+// The occurrence is locked in the database so only one instance creates it.
+func fireRecurring(id uint) {
+	occurrence := time.Now().UTC().Truncate(time.Minute)
+	if !acquireJobLock(fmt.Sprintf("recurring:%d:%s", id, occurrence.Format(time.RFC3339))) {
+		return
+	}
+
+	var rec RecurringMessage
+	if err := db.First(&rec, id).Error; err != nil {
+		log.Printf("Recurring message %d not found: %v", id, err)
+		unregisterRecurring(id)
+		return
+	}
+
+	now := time.Now().UTC()
+	if !rec.Active || now.Before(rec.StartsAt) {
+		return
+	}
+
+	message := Message{
+		TenantID:     rec.TenantID,
+		CreatedBy:    rec.CreatedBy,
+		RecurringID:  &rec.ID,
+		PhoneNumber:  rec.PhoneNumber,
+		Category:     rec.Category,
+		Content:      rec.Content,
+		SkipFooter:   rec.SkipFooter,
+		MediaKey:     rec.MediaKey,
+		VariablesURL: rec.VariablesURL,
+		MaxStaleness: rec.MaxStaleness,
+		Account:      rec.Account,
+		ScheduledAt:  now,
+		Status:       queuedStatus(),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	message.Segments, _ = countSegments(renderContent(message))
+	// Consent may have been revoked since the recurrence was scheduled
+	if apiErr := attachConsent(&message); apiErr != nil {
+		log.Printf("Skipping occurrence of recurring message %d: %s", id, apiErr.Message)
+		return
+	}
+
+	if err := db.Create(&message).Error; err != nil {
+		log.Printf("Failed to create occurrence of recurring message %d: %v", id, err)
+		return
+	}
+	db.Model(&rec).Updates(map[string]interface{}{"last_fired_at": now, "updated_at": now})
+	log.Printf("Recurring message %d created message %d", id, message.ID)
+}
+
+// scheduleRecurring handles a schedule request carrying a recurrence preset
+func scheduleRecurring(c *gin.Context, req ScheduleMessageRequest, startsAt time.Time) {
+	spec, ok := recurrencePresets[req.Recurrence]
+	if !ok {
+		respondAPIError(c, http.StatusBadRequest, &apiError{
+			Code:    codeUnknownRecurrence,
+			Message: "Unknown recurrence preset",
+			Details: gin.H{"recurrence": req.Recurrence, "allowed": presetNames()},
+		})
+		return
+	}
+
+	maxStaleness, _ := parseMaxStaleness(req.MaxStaleness)
+	rec := RecurringMessage{
+		TenantID:     tenantID(c),
+		CreatedBy:    requestActor(c),
+		PhoneNumber:  req.PhoneNumber,
+		Category:     req.Category,
+		Content:      req.Content,
+		SkipFooter:   req.SkipFooter,
+		MediaKey:     req.MediaKey,
+		VariablesURL: req.VariablesURL,
+		MaxStaleness: maxStaleness,
+		Account:      req.Account,
+		Preset:       req.Recurrence,
+		CronSpec:     spec,
+		StartsAt:     startsAt,
+		Active:       true,
+	}
+	if err := db.Create(&rec).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to schedule recurring message")
+		return
+	}
+	if err := registerRecurring(rec); err != nil {
+		log.Printf("Failed to register recurring message %d: %v", rec.ID, err)
+		respondError(c, http.StatusInternalServerError, "Failed to schedule recurring message")
+		return
+	}
+
+	respond(c, http.StatusCreated, rec)
+}
+
+func getRecurringMessages(c *gin.Context) {
+	var recurring []RecurringMessage
+	if err := db.Scopes(forTenant(c)).Order("created_at DESC").Find(&recurring).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to fetch recurring messages")
+		return
+	}
+
+	respond(c, http.StatusOK, recurring)
+}
+
+// stopRecurringMessage deactivates a recurring message; occurrences already created are kept
+func stopRecurringMessage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, "Invalid recurring message ID")
+		return
+	}
+
+	var rec RecurringMessage
+	if err := db.Scopes(forTenant(c)).First(&rec, uint(id)).Error; err != nil {
+		respondErrorCode(c, http.StatusNotFound, codeRecurringNotFound, "Recurring message not found")
+		return
+	}
+
+	rec.Active = false
+	if err := db.Save(&rec).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to stop recurring message")
+		return
+	}
+	unregisterRecurring(rec.ID)
+
+	respond(c, http.StatusOK, rec)
+}
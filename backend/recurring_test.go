@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFireRecurringCopiesDefinition(t *testing.T) {
+	useTestDB(t)
+	rec := RecurringMessage{
+		PhoneNumber:  "+15551230001",
+		Content:      "",
+		MediaKey:     "flyers/weekly.png",
+		VariablesURL: "https://crm.example.com/variables",
+		MaxStaleness: 600,
+		Preset:       "daily",
+		CronSpec:     "0 9 * * *",
+		StartsAt:     time.Now().UTC().Add(-time.Hour),
+		Active:       true,
+	}
+	if err := db.Create(&rec).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	fireRecurring(rec.ID)
+
+	var occurrence Message
+	if err := db.Where("recurring_id = ?", rec.ID).First(&occurrence).Error; err != nil {
+		t.Fatalf("no occurrence created: %v", err)
+	}
+	if occurrence.MediaKey != rec.MediaKey {
+		t.Errorf("occurrence media_key = %q, want %q", occurrence.MediaKey, rec.MediaKey)
+	}
+	if occurrence.VariablesURL != rec.VariablesURL {
+		t.Errorf("occurrence variables_url = %q, want %q", occurrence.VariablesURL, rec.VariablesURL)
+	}
+	if occurrence.MaxStaleness != rec.MaxStaleness {
+		t.Errorf("occurrence max_staleness_seconds = %d, want %d", occurrence.MaxStaleness, rec.MaxStaleness)
+	}
+}
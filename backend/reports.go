@@ -0,0 +1,296 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// deliverySLA is the longest acceptable gap between sending and delivery, from DELIVERY_SLA
+var deliverySLA time.Duration
+
+// throughputBuckets maps the supported bucket sizes to SQLite strftime formats
+var throughputBuckets = map[string]string{
+	"1h":   "%Y-%m-%dT%H:00:00Z",
+	"hour": "%Y-%m-%dT%H:00:00Z",
+	"1d":   "%Y-%m-%dT00:00:00Z",
+	"day":  "%Y-%m-%dT00:00:00Z",
+}
+
+// parseReportRange reads the from/to query parameters, defaulting to the last 24 hours
+func parseReportRange(c *gin.Context) (time.Time, time.Time, bool) {
+	to := time.Now().UTC()
+	from := to.Add(-24 * time.Hour)
+
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidDate, "Invalid from date. Use ISO 8601 format.")
+			return from, to, false
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidDate, "Invalid to date. Use ISO 8601 format.")
+			return from, to, false
+		}
+	}
+	if !from.Before(to) {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidDateRange, "from must be before to")
+		return from, to, false
+	}
+	return from.UTC(), to.UTC(), true
+}
+
+// getThroughputReport counts sent messages per hour or day bucket of their sent time
+func getThroughputReport(c *gin.Context) {
+	bucket := c.DefaultQuery("bucket", "1h")
+	format, ok := throughputBuckets[bucket]
+	if !ok {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, "Invalid bucket. Use 1h or 1d.")
+		return
+	}
+
+	from, to, ok := parseReportRange(c)
+	if !ok {
+		return
+	}
+
+	buckets := []struct {
+		Bucket string `json:"bucket"`
+		Count  int64  `json:"count"`
+	}{}
+	err := db.Model(&Message{}).
+		Scopes(forTenant(c)).
+		Select("strftime(?, sent_at) AS bucket, COUNT(*) AS count", format).
+		Where("sent_at IS NOT NULL AND sent_at >= ? AND sent_at < ?", from, to).
+		Group("bucket").
+		Order("bucket ASC").
+		Scan(&buckets).Error
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to build throughput report")
+		return
+	}
+
+	var total int64
+	for _, b := range buckets {
+		total += b.Count
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"from":    from,
+		"to":      to,
+		"bucket":  bucket,
+		"total":   total,
+		"buckets": buckets,
+	})
+}
+
+// slaBreach is a delivered message whose delivery took longer than the SLA
+type slaBreach struct {
+	ID           uint      `json:"id"`
+	PhoneNumber  string    `json:"phone_number"`
+	SentAt       time.Time `json:"sent_at"`
+	DeliveredAt  time.Time `json:"delivered_at"`
+	DelaySeconds float64   `json:"delay_seconds"`
+}
+
+// getSLAReport lists messages sent in the range whose delivery took longer than the SLA.
+// The sla query parameter overrides DELIVERY_SLA for a single report.
+func getSLAReport(c *gin.Context) {
+	sla := deliverySLA
+	if value := c.Query("sla"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidDuration, "Invalid sla. Use a duration such as 5m.")
+			return
+		}
+		sla = parsed
+	}
+
+	from, to, ok := parseReportRange(c)
+	if !ok {
+		return
+	}
+
+	var delivered []Message
+	err := db.Scopes(forTenant(c)).
+		Where("sent_at >= ? AND sent_at < ? AND delivered_at IS NOT NULL", from, to).
+		Order("sent_at ASC").
+		Find(&delivered).Error
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to build SLA report")
+		return
+	}
+
+	breaches := []slaBreach{}
+	var totalDelay, maxDelay time.Duration
+	for _, message := range delivered {
+		delay := message.DeliveredAt.Sub(*message.SentAt)
+		totalDelay += delay
+		if delay > maxDelay {
+			maxDelay = delay
+		}
+		if delay > sla {
+			breaches = append(breaches, slaBreach{
+				ID:           message.ID,
+				PhoneNumber:  message.PhoneNumber,
+				SentAt:       *message.SentAt,
+				DeliveredAt:  *message.DeliveredAt,
+				DelaySeconds: delay.Seconds(),
+			})
+		}
+	}
+
+	var avgDelay float64
+	if len(delivered) > 0 {
+		avgDelay = totalDelay.Seconds() / float64(len(delivered))
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"from":              from,
+		"to":                to,
+		"sla_seconds":       sla.Seconds(),
+		"delivered":         len(delivered),
+		"breached":          len(breaches),
+		"avg_delay_seconds": avgDelay,
+		"max_delay_seconds": maxDelay.Seconds(),
+		"breaches":          breaches,
+	})
+}
+
+// failureReason is one group of the failure report
+type failureReason struct {
+	ErrorCode  int    `json:"error_code,omitempty"`
+	Reason     string `json:"reason"`
+	Count      int    `json:"count"`
+	MessageIDs []uint `json:"example_message_ids"` // up to five
+}
+
+// getFailureReport groups failed and undelivered messages updated in the range by Twilio
+// error code, falling back to the stored error text for failures without a code
+func getFailureReport(c *gin.Context) {
+	from, to, ok := parseReportRange(c)
+	if !ok {
+		return
+	}
+
+	query := db.Scopes(forTenant(c)).
+		Where("status IN ? AND updated_at >= ? AND updated_at < ?", []string{"failed", "undelivered"}, from, to)
+	if campaignID := c.Query("campaign_id"); campaignID != "" {
+		query = query.Where("campaign_id = ?", campaignID)
+	}
+	var failed []Message
+	if err := query.Order("id ASC").Find(&failed).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to build failure report")
+		return
+	}
+
+	reasons := []*failureReason{}
+	byKey := make(map[string]*failureReason)
+	for _, message := range failed {
+		key, reason := message.LastError, message.LastError
+		if message.ErrorCode != 0 {
+			key = strconv.Itoa(message.ErrorCode)
+			reason = "Twilio error " + key
+		} else if reason == "" {
+			reason = "unknown (no error recorded)"
+		}
+
+		group, ok := byKey[key]
+		if !ok {
+			group = &failureReason{ErrorCode: message.ErrorCode, Reason: reason, MessageIDs: []uint{}}
+			byKey[key] = group
+			reasons = append(reasons, group)
+		}
+		group.Count++
+		if len(group.MessageIDs) < 5 {
+			group.MessageIDs = append(group.MessageIDs, message.ID)
+		}
+	}
+	sort.SliceStable(reasons, func(i, j int) bool { return reasons[i].Count > reasons[j].Count })
+
+	respond(c, http.StatusOK, gin.H{
+		"from":    from,
+		"to":      to,
+		"total":   len(failed),
+		"reasons": reasons,
+	})
+}
+
+// getLagMetrics reports how far the sender is behind: pending messages already past their
+// scheduled time, and how long the oldest of them has been waiting
+func getLagMetrics(c *gin.Context) {
+	now := time.Now().UTC()
+	overdue := db.Scopes(forTenant(c)).Model(&Message{}).Where("status = ? AND scheduled_at <= ?", "pending", now)
+
+	var count int64
+	if err := overdue.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to compute lag metrics")
+		return
+	}
+
+	var oldestSeconds float64
+	if count > 0 {
+		var oldest Message
+		if err := overdue.Session(&gorm.Session{}).Select("scheduled_at").Order("scheduled_at ASC").First(&oldest).Error; err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to compute lag metrics")
+			return
+		}
+		oldestSeconds = math.Round(now.Sub(oldest.ScheduledAt).Seconds())
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"oldest_overdue_seconds": oldestSeconds,
+		"overdue_count":          count,
+	})
+}
+
+// getHeatmapReport counts messages scheduled in the range by weekday and hour in the tz
+// timezone (default UTC). counts[0] is Sunday and counts[d][h] covers hour h of that day.
+func getHeatmapReport(c *gin.Context) {
+	loc, err := time.LoadLocation(c.DefaultQuery("tz", "UTC"))
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, "Unknown timezone")
+		return
+	}
+	from, to, ok := parseReportRange(c)
+	if !ok {
+		return
+	}
+
+	query := db.Scopes(forTenant(c)).Model(&Message{}).Where("scheduled_at >= ? AND scheduled_at < ?", from, to)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var scheduled []time.Time
+	if err := query.Pluck("scheduled_at", &scheduled).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to build heatmap report")
+		return
+	}
+
+	// Bucketed in Go: SQLite has no timezone support beyond fixed offsets, which break across DST
+	var counts [7][24]int
+	for _, at := range scheduled {
+		local := at.In(loc)
+		counts[local.Weekday()][local.Hour()]++
+	}
+	weekdays := make([]string, 7)
+	for day := range weekdays {
+		weekdays[day] = time.Weekday(day).String()
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"from":     from,
+		"to":       to,
+		"timezone": loc.String(),
+		"total":    len(scheduled),
+		"weekdays": weekdays,
+		"counts":   counts,
+	})
+}
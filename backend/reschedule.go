@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RescheduleFailedRequest selects failed messages to re-queue. All filters are optional.
+type RescheduleFailedRequest struct {
+	From        string `json:"from"`         // scheduled_at lower bound, ISO 8601
+	To          string `json:"to"`           // scheduled_at upper bound, ISO 8601
+	CampaignID  *uint  `json:"campaign_id"`  // only messages of this campaign
+	ScheduledAt string `json:"scheduled_at"` // new send time; defaults to now
+}
+
+// rescheduleFailed moves matching failed messages back to pending in one transaction. Messages
+// whose recipient no longer has the consent their category requires stay failed.
+func rescheduleFailed(c *gin.Context) {
+	var req RescheduleFailedRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+			return
+		}
+	}
+
+	filters := []func(*gorm.DB) *gorm.DB{forTenant(c)}
+	for _, bound := range []struct {
+		value, clause, name string
+	}{
+		{req.From, "scheduled_at >= ?", "from"},
+		{req.To, "scheduled_at <= ?", "to"},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidDate, "Invalid "+bound.name+" date. Use ISO 8601 format.")
+			return
+		}
+		clause, value := bound.clause, t.UTC()
+		filters = append(filters, func(tx *gorm.DB) *gorm.DB { return tx.Where(clause, value) })
+	}
+	if req.CampaignID != nil {
+		campaignID := *req.CampaignID
+		filters = append(filters, func(tx *gorm.DB) *gorm.DB { return tx.Where("campaign_id = ?", campaignID) })
+	}
+
+	scheduledAt := time.Now().UTC()
+	if req.ScheduledAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ScheduledAt)
+		if err != nil {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidDate, "Invalid date format. Use ISO 8601 format.")
+			return
+		}
+		scheduledAt = t.UTC()
+	}
+	if apiErr := checkScheduleHorizon(scheduledAt); apiErr != nil {
+		respondAPIError(c, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	var rescheduled, skipped int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var failed []Message
+		if err := tx.Scopes(filters...).Where("status = ?", "failed").Find(&failed).Error; err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		for _, message := range failed {
+			if apiErr := attachConsent(&message); apiErr != nil {
+				if apiErr.Code != codeConsentMissing {
+					return errors.New(apiErr.Message)
+				}
+				skipped++
+				continue
+			}
+			result := tx.Model(&Message{}).
+				Where("id = ? AND status = ?", message.ID, "failed").
+				// The SID of the failed send is cleared too, or the processor would take the message
+				// as already accepted by Twilio and mark it sent without resending it
+				Updates(map[string]interface{}{
+					"status":          "pending",
+					"scheduled_at":    scheduledAt,
+					"attempt_count":   0,
+					"next_attempt_at": nil,
+					"twilio_sid":      "",
+					"sent_via":        "",
+					"sent_at":         nil,
+					"consent_id":      message.ConsentID,
+					"updated_at":      now,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			rescheduled += result.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to reschedule messages")
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"rescheduled":        rescheduled,
+		"skipped_no_consent": skipped,
+		"scheduled_at":       scheduledAt,
+	})
+}
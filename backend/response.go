@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Every endpoint responds with the same envelope:
+//
+//	{"ok": true, "data": ...}
+//	{"ok": false, "error": {"code": "...", "message": "...", "details": {...}}}
+//
+// code is stable and machine-readable, so clients can localize errors; message is English
+// copy for humans and may change.
+
+// apiError is the error object of the response envelope
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details gin.H  `json:"details,omitempty"`
+}
+
+// Error codes for specific failures. Errors without one get the generic code of their HTTP status.
+const (
+	codeInvalidRequestBody  = "invalid_request_body"
+	codeInvalidPhoneNumber  = "invalid_phone_number"
+	codeInvalidDate         = "invalid_date"
+	codeInvalidDateRange    = "invalid_date_range"
+	codeInvalidDuration     = "invalid_duration"
+	codeInvalidParameter    = "invalid_parameter"
+	codeScheduledAtRequired = "scheduled_at_required"
+	codeScheduledInPast     = "scheduled_in_past"
+	codeScheduledTooFar     = "scheduled_too_far"
+	codeBlockedContent      = "blocked_content"
+	codeInvalidMessageID    = "invalid_message_id"
+	codeMessageNotFound     = "message_not_found"
+	codeMessageNotEditable  = "message_not_editable"
+	codeNotPendingApproval  = "message_not_pending_approval"
+	codeNotApprover         = "not_approver"
+	codeSelfApproval        = "self_approval"
+	codeNotAdmin            = "not_admin"
+	codeInvalidCampaignID   = "invalid_campaign_id"
+	codeCampaignNotFound    = "campaign_not_found"
+	codeCampaignCancelled   = "campaign_cancelled"
+	codeRecurringNotFound   = "recurring_message_not_found"
+	codeGroupNotFound       = "group_not_found"
+	codeGroupEmpty          = "group_empty"
+	codeConsentMissing      = "consent_missing"
+	codeConsentNotFound     = "consent_not_found"
+	codeUnknownRecurrence   = "unknown_recurrence"
+	codeInvalidAPIKey       = "invalid_api_key"
+	codeInvalidCSV          = "invalid_csv"
+	codeFileTooLarge        = "file_too_large"
+	codeBacklogFull         = "backlog_full"
+	codeNotConfigured       = "not_configured"
+	codeUnknownAccount      = "unknown_account"
+	codeSendingPaused       = "sending_paused"
+	codeProcessorBusy       = "processor_busy"
+	codeTwilioError         = "twilio_error"
+)
+
+// statusErrorCodes are the generic codes for errors that carry no specific one
+var statusErrorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusBadGateway:            "bad_gateway",
+	http.StatusServiceUnavailable:    "service_unavailable",
+}
+
+// respond writes a successful envelope carrying data, masking phone numbers when configured
+func respond(c *gin.Context, status int, data interface{}) {
+	if maskPhoneNumbers {
+		data = maskResponseData(data)
+	}
+	c.JSON(status, gin.H{"ok": true, "data": data})
+}
+
+// respondError writes a failed envelope with a plain message and the status's generic code
+func respondError(c *gin.Context, status int, message string) {
+	respondAPIError(c, status, &apiError{Message: message})
+}
+
+// respondErrorCode writes a failed envelope with a specific error code
+func respondErrorCode(c *gin.Context, status int, code, message string) {
+	respondAPIError(c, status, &apiError{Code: code, Message: message})
+}
+
+// respondAPIError writes a failed envelope, aborting any remaining handlers. Phone numbers in the
+// details, such as the recipient of a consent_missing error, are masked like respond's data.
+func respondAPIError(c *gin.Context, status int, err *apiError) {
+	if maskPhoneNumbers && err.Details != nil {
+		err.Details = maskResponseData(err.Details).(gin.H)
+	}
+	if err.Code == "" {
+		err.Code = statusErrorCodes[status]
+		if err.Code == "" {
+			err.Code = "error"
+		}
+	}
+	c.AbortWithStatusJSON(status, gin.H{"ok": false, "error": err})
+}
+
+// blockedContentError reports message content matching the blocklist
+func blockedContentError(term string) *apiError {
+	return &apiError{Code: codeBlockedContent, Message: "Message content contains a blocked term", Details: gin.H{"term": term}}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	gsm7Basic     = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extension = "^{}\\[~]|€\f"
+)
+
+// countSegments returns how many SMS segments content needs and the encoding carriers will use.
+// GSM-7 fits 160 characters in one segment (153 when concatenated), extension characters count
+// double; anything outside GSM-7 forces UCS-2 at 70 UTF-16 units (67 when concatenated).
+func countSegments(content string) (int, string) {
+	units := 0
+	gsm := true
+	for _, r := range content {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			units++
+		case strings.ContainsRune(gsm7Extension, r):
+			units += 2
+		default:
+			gsm = false
+		}
+		if !gsm {
+			break
+		}
+	}
+
+	single, multi, encoding := 160, 153, "GSM-7"
+	if !gsm {
+		units = len(utf16.Encode([]rune(content)))
+		single, multi, encoding = 70, 67, "UCS-2"
+	}
+
+	if units <= single {
+		return 1, encoding
+	}
+	return int(math.Ceil(float64(units) / float64(multi))), encoding
+}
+
+// pricePerSegment and priceCurrency drive cost estimates, from PRICE_PER_SEGMENT and PRICE_CURRENCY
+var pricePerSegment float64
+var priceCurrency string
+
+// EstimateRequest represents the request body for estimating the cost of a send
+type EstimateRequest struct {
+	Content    string `json:"content" binding:"required"`
+	Recipients int    `json:"recipients" binding:"required,min=1"`
+	SkipFooter bool   `json:"skip_footer"`
+}
+
+// estimateCost reports segment usage and, when a price is configured, the expected cost
+func estimateCost(c *gin.Context) {
+	var req EstimateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+		return
+	}
+
+	body := renderContent(Message{Content: req.Content, SkipFooter: req.SkipFooter})
+	segments, encoding := countSegments(body)
+	withoutFooter, _ := countSegments(req.Content)
+	totalSegments := segments * req.Recipients
+
+	estimate := gin.H{
+		"encoding":               encoding,
+		"characters":             len([]rune(body)),
+		"segments_per_recipient": segments,
+		"footer_extra_segments":  segments - withoutFooter,
+		"recipients":             req.Recipients,
+		"total_segments":         totalSegments,
+	}
+	if pricePerSegment > 0 {
+		estimate["price_per_segment"] = pricePerSegment
+		estimate["currency"] = priceCurrency
+		estimate["estimated_cost"] = math.Round(float64(totalSegments)*pricePerSegment*10000) / 10000
+	}
+
+	respond(c, http.StatusOK, estimate)
+}
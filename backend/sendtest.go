@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/twilio/twilio-go/client"
+)
+
+// allowTestSend enables POST /api/send-test, from ALLOW_TEST_SEND
+var allowTestSend bool
+
+// SendTestRequest is an immediate, unscheduled send used to check the Twilio setup
+type SendTestRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required"`
+	Content     string `json:"content" binding:"required"`
+	SkipFooter  bool   `json:"skip_footer"`
+}
+
+// sendTest sends one message synchronously, bypassing the queue and the circuit breaker,
+// and reports Twilio's answer. Nothing is stored.
+func sendTest(c *gin.Context) {
+	if !allowTestSend {
+		respondErrorCode(c, http.StatusForbidden, codeNotConfigured, "Test sends are disabled; set ALLOW_TEST_SEND=true to enable them")
+		return
+	}
+
+	var req SendTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+		return
+	}
+
+	phone, err := normalizePhoneNumber(req.PhoneNumber)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidPhoneNumber, err.Error())
+		return
+	}
+	if term, blocked := findBlockedTerm(req.Content); blocked {
+		respondAPIError(c, http.StatusBadRequest, blockedContentError(term))
+		return
+	}
+
+	message := Message{PhoneNumber: phone, Content: req.Content, SkipFooter: req.SkipFooter}
+	if err := sendMessage(&message); err != nil {
+		details := gin.H{"error": err.Error()}
+		var restErr *client.TwilioRestError
+		if errors.As(err, &restErr) {
+			details["twilio_status"] = restErr.Status
+			details["twilio_code"] = restErr.Code
+			details["more_info"] = restErr.MoreInfo
+		}
+		respondAPIError(c, http.StatusBadGateway, &apiError{Code: codeTwilioError, Message: "Test send failed", Details: details})
+		return
+	}
+
+	respond(c, http.StatusCreated, gin.H{
+		"twilio_sid":       message.TwilioSID,
+		"phone_number":     message.PhoneNumber,
+		"rendered_content": message.RenderedContent,
+		"segments":         message.Segments,
+	})
+}
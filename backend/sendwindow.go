@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SendWindow restricts a message to certain weekdays and hours, e.g. weekdays 09:00-17:00 in the
+// recipient's zone. Outside the window a due message waits for the next opening; with
+// max_staleness set it expires instead once the next opening would be past that deadline.
+type SendWindow struct {
+	Days     []string `json:"days,omitempty"`     // mon ... sun; empty allows every day
+	Start    string   `json:"start"`              // HH:MM local time the window opens
+	End      string   `json:"end"`                // HH:MM local time it closes, after Start
+	Timezone string   `json:"timezone,omitempty"` // IANA zone of the recipient; defaults to the request's timezone, then the server's
+}
+
+var sendWindowDays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// validateSendWindow checks an optional send window, filling in its timezone from the request,
+// and returns it encoded for storage
+func validateSendWindow(window *SendWindow, timezone string) (string, *apiError) {
+	if window == nil {
+		return "", nil
+	}
+	normalized := SendWindow{Start: window.Start, End: window.End, Timezone: window.Timezone}
+	if normalized.Timezone == "" {
+		normalized.Timezone = timezone
+	}
+	if normalized.Timezone != "" {
+		if _, err := time.LoadLocation(normalized.Timezone); err != nil {
+			return "", &apiError{Code: codeInvalidParameter, Message: "send_window timezone must be an IANA zone such as America/New_York", Details: gin.H{"timezone": normalized.Timezone}}
+		}
+	}
+
+	for _, day := range window.Days {
+		name := strings.ToLower(day)
+		if _, ok := sendWindowDays[name]; !ok {
+			return "", &apiError{Code: codeInvalidParameter, Message: "send_window days must be day abbreviations such as mon or fri", Details: gin.H{"day": day}}
+		}
+		normalized.Days = append(normalized.Days, name)
+	}
+
+	start, okStart := parseClock(window.Start)
+	end, okEnd := parseClock(window.End)
+	if !okStart || !okEnd || end <= start {
+		return "", &apiError{Code: codeInvalidParameter, Message: "send_window needs start and end as HH:MM with end after start, such as 09:00 and 17:00"}
+	}
+
+	encoded, err := json.Marshal(normalized)
+	if err != nil {
+		return "", &apiError{Code: codeInvalidParameter, Message: "Invalid send_window"}
+	}
+	return string(encoded), nil
+}
+
+// parseClock converts HH:MM to the offset from midnight
+func parseClock(raw string) (time.Duration, bool) {
+	clock, err := time.Parse("15:04", raw)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, true
+}
+
+// nextSendWindowOpening reports whether the message's send window is closed at now, and if so
+// when it next opens. Messages without a window are never held.
+func nextSendWindowOpening(message Message, now time.Time) (time.Time, bool) {
+	if message.SendWindow == "" {
+		return time.Time{}, false
+	}
+	var window SendWindow
+	if err := json.Unmarshal([]byte(message.SendWindow), &window); err != nil {
+		log.Printf("Ignoring unreadable send window of message %d: %v", message.ID, err)
+		return time.Time{}, false
+	}
+	loc := time.Local
+	if window.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(window.Timezone); err != nil {
+			log.Printf("Ignoring send window of message %d with unknown zone %s", message.ID, window.Timezone)
+			return time.Time{}, false
+		}
+	}
+	start, _ := parseClock(window.Start)
+	end, _ := parseClock(window.End)
+	allowed := make(map[time.Weekday]bool, len(window.Days))
+	for _, day := range window.Days {
+		allowed[sendWindowDays[day]] = true
+	}
+
+	local := now.In(loc)
+	for offset := 0; offset <= 7; offset++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, loc)
+		if len(allowed) > 0 && !allowed[day.Weekday()] {
+			continue
+		}
+		opens := time.Date(day.Year(), day.Month(), day.Day(), 0, int(start/time.Minute), 0, 0, loc)
+		closes := time.Date(day.Year(), day.Month(), day.Day(), 0, int(end/time.Minute), 0, 0, loc)
+		if offset == 0 && !local.Before(opens) && local.Before(closes) {
+			return time.Time{}, false
+		}
+		if opens.After(local) {
+			return opens.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// sendWindowMissesDeadline reports whether a window opening falls after the message's
+// max_staleness deadline, so waiting for it is pointless
+func sendWindowMissesDeadline(message Message, opens time.Time) bool {
+	return message.MaxStaleness > 0 && opens.After(message.ScheduledAt.Add(time.Duration(message.MaxStaleness)*time.Second))
+}
+
+// deferToSendWindow holds a pending message until its send window opens, without claiming it
+func deferToSendWindow(message *Message, opens time.Time) {
+	err := db.Model(&Message{}).
+		Where("id = ? AND status = ?", message.ID, "pending").
+		UpdateColumn("next_attempt_at", opens).Error
+	if err != nil {
+		log.Printf("Failed to defer message %d to its send window: %v", message.ID, err)
+		return
+	}
+	log.Printf("Message %d is outside its send window; deferred to %s", message.ID, opens.Format(time.RFC3339))
+}
+
+// sendWindowExpiry explains why a message whose window only reopens after its deadline expired
+func sendWindowExpiry(message Message, opens time.Time) string {
+	return fmt.Sprintf("send_window next opens at %s, after the max_staleness deadline of %ds", opens.Format(time.RFC3339), message.MaxStaleness)
+}
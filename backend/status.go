@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statusCallback is the subset of a Twilio status callback the webhook uses
+type statusCallback struct {
+	MessageSID string `json:"MessageSid"`
+	Status     string `json:"MessageStatus"`
+	To         string `json:"To"`
+	ErrorCode  int    `json:"-"` // set on failed and undelivered callbacks
+}
+
+// bindStatusCallback reads a status callback that Twilio sends form-encoded but proxies or
+// custom setups may forward as JSON. The declared content type is tried first, then the other.
+func bindStatusCallback(c *gin.Context) (statusCallback, error) {
+	var status statusCallback
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return status, err
+	}
+
+	parseJSON := func() bool {
+		var fields struct {
+			statusCallback
+			ErrorCode interface{} `json:"ErrorCode"` // a number, or a string from some proxies
+		}
+		if json.Unmarshal(body, &fields) != nil {
+			return false
+		}
+		status = fields.statusCallback
+		status.ErrorCode = parseErrorCode(fmt.Sprint(fields.ErrorCode))
+		return status.Status != "" && status.To != ""
+	}
+	parseForm := func() bool {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return false
+		}
+		status = statusCallback{
+			MessageSID: values.Get("MessageSid"),
+			Status:     values.Get("MessageStatus"),
+			To:         values.Get("To"),
+			ErrorCode:  parseErrorCode(values.Get("ErrorCode")),
+		}
+		return status.Status != "" && status.To != ""
+	}
+
+	contentType := c.ContentType()
+	looksJSON := strings.Contains(contentType, "json") || bytes.HasPrefix(bytes.TrimSpace(body), []byte("{"))
+	if looksJSON && (parseJSON() || parseForm()) || !looksJSON && (parseForm() || parseJSON()) {
+		return status, nil
+	}
+
+	log.Printf("Warning: unparseable status callback (Content-Type %q, %d bytes)", contentType, len(body))
+	return statusCallback{}, errors.New("Status callback must include MessageStatus and To, form-encoded or JSON")
+}
+
+// twilioCallbackStatuses are the MessageStatus values Twilio sends; anything else is ignored
+var twilioCallbackStatuses = map[string]bool{
+	"queued":      true,
+	"sending":     true,
+	"sent":        true,
+	"delivered":   true,
+	"undelivered": true,
+	"failed":      true,
+	"received":    true,
+}
+
+// parseErrorCode reads a callback's ErrorCode, 0 when absent or malformed
+func parseErrorCode(value string) int {
+	code, _ := strconv.Atoi(value)
+	return code
+}
+
+// statusOrdinals orders message statuses along the delivery lifecycle. Twilio can deliver
+// callbacks out of order, so a status only replaces one with a lower ordinal.
+// failed, undelivered, expired and skipped are terminal and share the highest rank.
+var statusOrdinals = map[string]int{
+	"pending":     0,
+	"processing":  0,
+	"queued":      1,
+	"sending":     2,
+	"sent":        3,
+	"delivered":   4,
+	"undelivered": 5,
+	"failed":      5,
+	"expired":     5,
+	"skipped":     5,
+}
+
+// isStatusAdvance reports whether moving from current to next progresses the lifecycle.
+// Statuses outside the lifecycle (draft, pending_approval, cancelled, rejected, ...) are never
+// overwritten by a callback.
+func isStatusAdvance(current, next string) bool {
+	currentRank, currentKnown := statusOrdinals[current]
+	nextRank, nextKnown := statusOrdinals[next]
+	if !currentKnown || !nextKnown {
+		return false
+	}
+	return nextRank > currentRank
+}
+
+// terminalStatuses are the statuses a message no longer leaves on its own; sent is included
+// because a missing delivery receipt never arrives once a message is days old
+var terminalStatuses = []string{"sent", "delivered", "undelivered", "failed", "cancelled", "expired", "skipped", "rejected"}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// statusCoalescer buffers status callbacks and writes each batch in one transaction, so the
+// burst of receipts at the end of a campaign does not contend for SQLite's write lock. Twilio is
+// acknowledged as soon as a callback is buffered; callbacks still buffered when the process
+// exits are lost.
+type statusCoalescer struct {
+	window    time.Duration // longest a callback waits in the buffer, from STATUS_COALESCE_WINDOW
+	maxEvents int           // buffered callbacks that trigger an early flush, from STATUS_COALESCE_MAX
+
+	mu      sync.Mutex
+	pending []statusCallback // arrival order
+	full    chan struct{}
+}
+
+// statusBatcher is nil unless STATUS_COALESCE_WINDOW is set, and callbacks are written one by one
+var statusBatcher *statusCoalescer
+
+func loadStatusCoalescer() {
+	window := getEnvDuration("STATUS_COALESCE_WINDOW", 0)
+	if window <= 0 {
+		return
+	}
+	statusBatcher = &statusCoalescer{
+		window:    window,
+		maxEvents: max(getEnvInt("STATUS_COALESCE_MAX", 200), 1),
+		full:      make(chan struct{}, 1),
+	}
+	go statusBatcher.run()
+}
+
+// add buffers one callback, waking the flusher early once the buffer is full
+func (b *statusCoalescer) add(status statusCallback) {
+	b.mu.Lock()
+	b.pending = append(b.pending, status)
+	full := len(b.pending) >= b.maxEvents
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *statusCoalescer) run() {
+	ticker := time.NewTicker(b.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.full:
+		}
+		b.flush()
+	}
+}
+
+// flush writes everything buffered so far, retrying while the database is busy
+func (b *statusCoalescer) flush() {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	var updated int
+	err := withDBRetry(func() error {
+		var err error
+		updated, err = applyStatusCallbacks(batch)
+		return err
+	})
+	if err != nil {
+		log.Printf("ALERT: dropped %d buffered status callbacks after the batch write failed: %v", len(batch), err)
+		return
+	}
+	if updated > 0 {
+		log.Printf("Applied %d buffered status callbacks (%d message updates)", len(batch), updated)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// StatusEvent is the JSON payload delivered to STATUS_WEBHOOK_URL
+type StatusEvent struct {
+	Type           string    `json:"type"`
+	MessageID      uint      `json:"message_id,omitempty"`
+	PhoneNumber    string    `json:"phone_number,omitempty"`
+	Status         string    `json:"status,omitempty"`
+	PreviousStatus string    `json:"previous_status,omitempty"`
+	Balance        *float64  `json:"balance,omitempty"` // low_balance events only
+	Currency       string    `json:"currency,omitempty"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
+const (
+	statusWebhookQueueSize   = 1000
+	statusWebhookMaxAttempts = 5
+)
+
+var statusWebhookURL string
+var statusEvents chan StatusEvent
+var webhookHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// initStatusWebhook starts the delivery worker when STATUS_WEBHOOK_URL is configured
+func initStatusWebhook() {
+	statusWebhookURL = os.Getenv("STATUS_WEBHOOK_URL")
+	loadWebhookSecrets()
+	if statusWebhookURL == "" {
+		return
+	}
+
+	statusEvents = make(chan StatusEvent, statusWebhookQueueSize)
+	go statusWebhookWorker()
+}
+
+// publishStatusChange records a status transition in the status history and queues it for the
+// global webhook without blocking the caller
+func publishStatusChange(message Message, previousStatus string) {
+	now := time.Now().UTC()
+	recordStatusChange(message, previousStatus, now)
+	publishEvent(StatusEvent{
+		Type:           "status_changed",
+		MessageID:      message.ID,
+		PhoneNumber:    message.PhoneNumber,
+		Status:         message.Status,
+		PreviousStatus: previousStatus,
+		OccurredAt:     now,
+	})
+}
+
+// publishStatusEvents queues the events of a bulk transition whose history recordStatusChanges
+// already wrote; each message carries its previous status
+func publishStatusEvents(messages []Message, status string, at time.Time) {
+	for _, message := range messages {
+		publishEvent(StatusEvent{
+			Type:           "status_changed",
+			MessageID:      message.ID,
+			PhoneNumber:    message.PhoneNumber,
+			Status:         status,
+			PreviousStatus: message.Status,
+			OccurredAt:     at,
+		})
+	}
+}
+
+func publishEvent(event StatusEvent) {
+	if statusEvents == nil {
+		return
+	}
+
+	select {
+	case statusEvents <- event:
+	default:
+		log.Printf("Status webhook queue full, dropping %s event for message %d", event.Type, event.MessageID)
+	}
+}
+
+func statusWebhookWorker() {
+	for event := range statusEvents {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Failed to encode status event: %v", err)
+			continue
+		}
+
+		delay := time.Second
+		for attempt := 1; attempt <= statusWebhookMaxAttempts; attempt++ {
+			err = deliverStatusEvent(body)
+			if err == nil {
+				break
+			}
+			if attempt < statusWebhookMaxAttempts {
+				log.Printf("Status webhook attempt %d failed: %v. Retrying in %s...", attempt, err, delay)
+				time.Sleep(delay)
+				delay *= 2
+			}
+		}
+		if err != nil {
+			log.Printf("Giving up on status webhook for message %d after %d attempts: %v", event.MessageID, statusWebhookMaxAttempts, err)
+		}
+	}
+}
+
+func deliverStatusEvent(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, statusWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// While a rotation is in its grace period the previous secret signs too, so receivers
+	// still holding it keep verifying
+	current, previous := statusWebhookSecrets.signingSecrets()
+	if current != "" {
+		req.Header.Set("X-Signature-256", "sha256="+signPayload(current, body))
+	}
+	if previous != "" {
+		req.Header.Set("X-Signature-256-Previous", "sha256="+signPayload(previous, body))
+	}
+
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signPayload returns the hex-encoded HMAC-SHA256 of body, which receivers recompute to verify authenticity
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// strictJSON rejects schedule bodies carrying fields the API does not know, from STRICT_JSON.
+// Without it unknown fields are ignored, so a typo such as phonenumber only surfaces as a
+// confusing required-field error, or not at all for optional fields.
+var strictJSON bool
+
+// bindScheduleJSON binds a schedule-style JSON body into req, writing a 400 response on failure.
+// With STRICT_JSON on, the response names the first unknown field.
+func bindScheduleJSON(c *gin.Context, req interface{}) bool {
+	if !strictJSON {
+		if err := c.ShouldBindJSON(req); err != nil {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+			return false
+		}
+		return true
+	}
+
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(req)
+	if errors.Is(err, io.EOF) {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, "Request body is empty")
+		return false
+	}
+	if err != nil {
+		// encoding/json reports these as `json: unknown field "name"` with no typed error
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			field = strings.Trim(field, `"`)
+			respondAPIError(c, http.StatusBadRequest, &apiError{
+				Code:    codeInvalidRequestBody,
+				Message: "Unknown field " + field,
+				Details: gin.H{"field": field},
+			})
+			return false
+		}
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+		return false
+	}
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidRequestBody, err.Error())
+		return false
+	}
+	return true
+}
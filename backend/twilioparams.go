@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	api "github.com/twilio/twilio-go/rest/api/v2010"
+)
+
+// twilioParamSetters are the Twilio Create Message parameters a request may pass through in
+// twilio_params, keyed by Twilio's parameter name. Parameters this service sets itself (To, From,
+// Body, StatusCallback, the scheduling fields) are deliberately absent.
+var twilioParamSetters = map[string]func(params *api.CreateMessageParams, value string) error{
+	"ValidityPeriod": func(params *api.CreateMessageParams, value string) error {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 1 || seconds > 36000 {
+			return errors.New("must be a number of seconds between 1 and 36000")
+		}
+		params.SetValidityPeriod(seconds)
+		return nil
+	},
+	"MaxPrice": func(params *api.CreateMessageParams, value string) error {
+		price, err := strconv.ParseFloat(value, 32)
+		if err != nil || price <= 0 {
+			return errors.New("must be a positive price such as 0.05")
+		}
+		params.SetMaxPrice(float32(price))
+		return nil
+	},
+	"SmartEncoded":     boolTwilioParam((*api.CreateMessageParams).SetSmartEncoded),
+	"ShortenUrls":      boolTwilioParam((*api.CreateMessageParams).SetShortenUrls),
+	"ProvideFeedback":  boolTwilioParam((*api.CreateMessageParams).SetProvideFeedback),
+	"SendAsMms":        boolTwilioParam((*api.CreateMessageParams).SetSendAsMms),
+	"ContentRetention": enumTwilioParam((*api.CreateMessageParams).SetContentRetention, "retain", "discard"),
+	"AddressRetention": enumTwilioParam((*api.CreateMessageParams).SetAddressRetention, "retain", "obfuscate"),
+	"RiskCheck":        enumTwilioParam((*api.CreateMessageParams).SetRiskCheck, "enable", "disable"),
+}
+
+func boolTwilioParam(set func(*api.CreateMessageParams, bool) *api.CreateMessageParams) func(*api.CreateMessageParams, string) error {
+	return func(params *api.CreateMessageParams, value string) error {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		set(params, enabled)
+		return nil
+	}
+}
+
+func enumTwilioParam(set func(*api.CreateMessageParams, string) *api.CreateMessageParams, allowed ...string) func(*api.CreateMessageParams, string) error {
+	return func(params *api.CreateMessageParams, value string) error {
+		for _, option := range allowed {
+			if value == option {
+				set(params, value)
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %v", allowed)
+	}
+}
+
+// errInvalidTwilioParams fails a send whose stored twilio_params no longer validate, e.g. after
+// a key was dropped from the whitelist; retrying cannot fix it
+var errInvalidTwilioParams = errors.New("invalid twilio_params")
+
+// twilioParamNames lists the accepted twilio_params keys, for error messages
+func twilioParamNames() []string {
+	names := make([]string, 0, len(twilioParamSetters))
+	for name := range twilioParamSetters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateTwilioParams checks a request's twilio_params against the whitelist and returns them
+// encoded for storage, empty when there are none
+func validateTwilioParams(raw map[string]string) (string, *apiError) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+	scratch := &api.CreateMessageParams{}
+	for name, value := range raw {
+		set, ok := twilioParamSetters[name]
+		if !ok {
+			return "", &apiError{Code: codeInvalidParameter, Message: fmt.Sprintf("Unsupported twilio_params key %q", name), Details: gin.H{"key": name, "supported": twilioParamNames()}}
+		}
+		if err := set(scratch, value); err != nil {
+			return "", &apiError{Code: codeInvalidParameter, Message: fmt.Sprintf("twilio_params %s %v", name, err), Details: gin.H{"key": name, "value": value}}
+		}
+	}
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return "", &apiError{Code: codeInvalidParameter, Message: "twilio_params must be an object of strings"}
+	}
+	return string(encoded), nil
+}
+
+// applyTwilioParams sets a message's stored twilio_params on the outgoing Twilio request
+func applyTwilioParams(params *api.CreateMessageParams, encoded string) error {
+	if encoded == "" {
+		return nil
+	}
+	var raw map[string]string
+	if err := json.Unmarshal([]byte(encoded), &raw); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidTwilioParams, err)
+	}
+	for name, value := range raw {
+		set, ok := twilioParamSetters[name]
+		if !ok {
+			return fmt.Errorf("%w: %s is no longer supported", errInvalidTwilioParams, name)
+		}
+		if err := set(params, value); err != nil {
+			return fmt.Errorf("%w: %s %v", errInvalidTwilioParams, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// uploadMaxBytes caps the size of CSV uploads, from UPLOAD_MAX_BYTES
+var uploadMaxBytes int64
+
+// uploadRowResult reports the outcome of a single CSV row
+type uploadRowResult struct {
+	Line      int    `json:"line"`
+	OK        bool   `json:"ok"`
+	MessageID uint   `json:"message_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+}
+
+var requiredUploadColumns = []string{"phone_number", "content"}
+
+// uploadColumns are the CSV columns with a meaning of their own; any other column is a
+// template variable filling the {{name}} placeholders of that row's content
+var uploadColumns = map[string]bool{
+	"phone_number": true,
+	"content":      true,
+	"scheduled_at": true,
+	"timezone":     true,
+	"anchor_at":    true,
+	"offset":       true,
+	"account":      true,
+	"category":     true,
+}
+
+// uploadSchedule schedules every valid row of a CSV file with columns
+// phone_number, content, scheduled_at and optional timezone and account columns. Drip lists may give
+// anchor_at and offset columns instead of scheduled_at, one anchor per recipient.
+// Extra columns become per-row template variables rendered into the content when the row is
+// scheduled; the content may come from a content form field shared by every row instead of a
+// column. Rows leaving a placeholder without a value are reported as failed.
+// With the dedupe form field set, rows repeating an earlier row are dropped;
+// a stagger form field spreads the accepted rows out like campaign creation does.
+func uploadSchedule(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, uploadMaxBytes)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			respondErrorCode(c, http.StatusRequestEntityTooLarge, codeFileTooLarge, fmt.Sprintf("File exceeds the %d byte upload limit", uploadMaxBytes))
+			return
+		}
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidCSV, "Missing CSV file in the \"file\" form field")
+		return
+	}
+	if fileHeader.Size > uploadMaxBytes {
+		respondErrorCode(c, http.StatusRequestEntityTooLarge, codeFileTooLarge, fmt.Sprintf("File exceeds the %d byte upload limit", uploadMaxBytes))
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidCSV, "Failed to read uploaded file")
+		return
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		respondCSVError(c, err)
+		return
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	template := c.PostForm("content")
+	for _, name := range requiredUploadColumns {
+		if _, ok := columns[name]; !ok && !(name == "content" && template != "") {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidCSV, fmt.Sprintf("CSV header is missing the %s column", name))
+			return
+		}
+	}
+	_, hasScheduledAt := columns["scheduled_at"]
+	_, hasAnchorAt := columns["anchor_at"]
+	_, hasOffset := columns["offset"]
+	if !hasScheduledAt && !(hasAnchorAt && hasOffset) {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidCSV, "CSV header needs a scheduled_at column, or anchor_at and offset columns")
+		return
+	}
+
+	stagger, err := parseStagger(c.PostForm("stagger"))
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidDuration, err.Error())
+		return
+	}
+
+	dedupe := c.PostForm("dedupe") == "true"
+	firstLine := make(map[string]int)
+	duplicates := 0
+
+	var results []uploadRowResult
+	var messages []Message
+	var messageRows []int // index into results for each message
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			respondCSVError(c, err)
+			return
+		}
+
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			if name == "content" {
+				return template
+			}
+			return ""
+		}
+		variables := make(map[string]string)
+		for name, i := range columns {
+			if !uploadColumns[name] && i < len(record) {
+				variables[name] = strings.TrimSpace(record[i])
+			}
+		}
+
+		message, rowErr := buildUploadMessage(c, field, variables)
+		if rowErr != "" {
+			results = append(results, uploadRowResult{Line: line, Error: rowErr})
+			continue
+		}
+		if dedupe {
+			key := dedupeKey(message)
+			if first, ok := firstLine[key]; ok {
+				results = append(results, uploadRowResult{Line: line, Duplicate: true, Error: fmt.Sprintf("duplicate of line %d", first)})
+				duplicates++
+				continue
+			}
+			firstLine[key] = line
+		}
+		results = append(results, uploadRowResult{Line: line, OK: true})
+		messages = append(messages, message)
+		messageRows = append(messageRows, len(results)-1)
+	}
+
+	if len(results) == 0 {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidCSV, "CSV file contains no rows")
+		return
+	}
+
+	if len(messages) > 0 {
+		applyStagger(messages, stagger)
+		if !checkBackpressure(c, len(messages)) {
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return tx.Create(&messages).Error
+		})
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to schedule messages")
+			return
+		}
+		for i, message := range messages {
+			results[messageRows[i]].MessageID = message.ID
+		}
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"created":            len(messages),
+		"failed":             len(results) - len(messages) - duplicates,
+		"duplicates_dropped": duplicates,
+		"results":            results,
+	})
+}
+
+// buildUploadMessage validates one CSV row, returning the message or a row error
+func buildUploadMessage(c *gin.Context, field func(string) string, variables map[string]string) (Message, string) {
+	for _, name := range requiredUploadColumns {
+		if field(name) == "" {
+			return Message{}, name + " is required"
+		}
+	}
+
+	if field("scheduled_at") == "" && field("anchor_at") == "" {
+		return Message{}, "scheduled_at is required"
+	}
+
+	content, rowErr := renderUploadContent(field("content"), variables)
+	if rowErr != "" {
+		return Message{}, rowErr
+	}
+
+	req := ScheduleMessageRequest{
+		PhoneNumber: field("phone_number"),
+		Content:     content,
+		ScheduledAt: field("scheduled_at"),
+		AnchorAt:    field("anchor_at"),
+		Timezone:    field("timezone"),
+		Offset:      field("offset"),
+		Account:     field("account"),
+		Category:    field("category"),
+	}
+	resolvedAt, apiErr := validateScheduleRequest(&req)
+	if apiErr != nil {
+		return Message{}, apiErr.Message
+	}
+
+	message := newMessage(c, req, resolvedAt)
+	if apiErr := attachConsent(&message); apiErr != nil {
+		return Message{}, apiErr.Message
+	}
+	return message, ""
+}
+
+// renderUploadContent fills the content's {{name}} placeholders from the row's variable columns.
+// A placeholder whose column is absent or blank on this row is an error naming every such variable.
+func renderUploadContent(content string, variables map[string]string) (string, string) {
+	var missing []string
+	for _, match := range variablePattern.FindAllStringSubmatch(content, -1) {
+		if variables[strings.ToLower(match[1])] == "" && !slices.Contains(missing, match[1]) {
+			missing = append(missing, match[1])
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return "", "missing template variables: " + strings.Join(missing, ", ")
+	}
+
+	return variablePattern.ReplaceAllStringFunc(content, func(placeholder string) string {
+		return variables[strings.ToLower(variablePattern.FindStringSubmatch(placeholder)[1])]
+	}), ""
+}
+
+func respondCSVError(c *gin.Context, err error) {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		respondAPIError(c, http.StatusBadRequest, &apiError{
+			Code:    codeInvalidCSV,
+			Message: "Malformed CSV: " + parseErr.Err.Error(),
+			Details: gin.H{"line": parseErr.Line},
+		})
+		return
+	}
+	if err == io.EOF {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidCSV, "CSV file is empty")
+		return
+	}
+	respondErrorCode(c, http.StatusBadRequest, codeInvalidCSV, "Failed to read CSV: "+err.Error())
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// upsertMessageByKey handles PUT /schedule/by-key/:external_key for sync jobs that mirror an
+// external system: it creates the message the first time a key is seen and replaces the editable
+// message carrying the key afterwards. Replaying the same request changes nothing.
+func upsertMessageByKey(c *gin.Context) {
+	key := c.Param("external_key")
+	if len(key) > 255 {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, "external_key must be at most 255 characters")
+		return
+	}
+
+	var req ScheduleMessageRequest
+	if !bindScheduleJSON(c, &req) {
+		return
+	}
+	if req.GroupID != nil || req.Recurrence != "" || req.DedupeKey != "" || req.Draft {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidParameter, "group_id, recurrence, dedupe_key and draft cannot be used with an external key")
+		return
+	}
+
+	var existing Message
+	result := db.Scopes(forTenant(c)).Where("external_key = ?", key).Limit(1).Find(&existing)
+	if result.Error != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to look up message")
+		return
+	}
+	if result.RowsAffected == 0 {
+		createMessageByKey(c, key, req)
+		return
+	}
+
+	if !messageEditable(existing) {
+		respondAPIError(c, http.StatusConflict, &apiError{
+			Code:    codeMessageNotEditable,
+			Message: "The message with this external key is no longer pending",
+			Details: gin.H{"id": existing.ID, "status": existing.Status},
+		})
+		return
+	}
+	scheduledAt, apiErr := validateMessageUpdate(&req)
+	if apiErr != nil {
+		respondAPIError(c, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	message := existing
+	applyMessageUpdate(&message, req, scheduledAt)
+	outcome := "unchanged"
+	if !sameMessageContent(existing, message) {
+		outcome = "updated"
+		if apiErr := attachConsent(&message); apiErr != nil {
+			respondAPIError(c, consentErrorStatus(apiErr), apiErr)
+			return
+		}
+		if err := db.Save(&message).Error; err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to update message")
+			return
+		}
+	} else {
+		message = existing
+	}
+
+	if message.Status == "pending" {
+		estimate := estimatedSendAt(message.ScheduledAt)
+		message.EstimatedSendAt = &estimate
+	}
+	respond(c, http.StatusOK, gin.H{"result": outcome, "message": message})
+}
+
+// createMessageByKey schedules the first message for an external key
+func createMessageByKey(c *gin.Context, key string, req ScheduleMessageRequest) {
+	scheduledAt, apiErr := validateScheduleRequest(&req)
+	if apiErr != nil {
+		respondAPIError(c, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	message := newMessage(c, req, scheduledAt)
+	message.ExternalKey = key
+	if apiErr := attachConsent(&message); apiErr != nil {
+		respondAPIError(c, consentErrorStatus(apiErr), apiErr)
+		return
+	}
+	if !req.anchorPassed && !checkBackpressure(c, 1) {
+		return
+	}
+	// The unique index on (tenant_id, external_key) rejects a concurrent create for the same key
+	if err := db.Create(&message).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to schedule message")
+		return
+	}
+
+	if message.Status == "pending" {
+		estimate := estimatedSendAt(message.ScheduledAt)
+		message.EstimatedSendAt = &estimate
+	}
+	respond(c, http.StatusCreated, gin.H{"result": "created", "message": message})
+}
+
+// sameMessageContent reports whether an update left everything a request controls as it was
+func sameMessageContent(before, after Message) bool {
+	return before.PhoneNumber == after.PhoneNumber &&
+		before.Content == after.Content &&
+		before.ContentSID == after.ContentSID &&
+		before.ContentVariables == after.ContentVariables &&
+		before.TwilioParams == after.TwilioParams &&
+		before.SendWindow == after.SendWindow &&
+		before.SkipFooter == after.SkipFooter &&
+		before.VariablesURL == after.VariablesURL &&
+		before.MaxStaleness == after.MaxStaleness &&
+		before.ScheduledAt.Equal(after.ScheduledAt)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const variablesMaxBytes = 64 << 10
+
+// variablesAllowPrivate lets variables_url reach loopback and private networks, from
+// VARIABLES_ALLOW_PRIVATE; only for development, since any tenant chooses the URL
+var variablesAllowPrivate bool
+
+// errPrivateVariablesHost refuses a variables lookup that resolves to a non-public address
+var errPrivateVariablesHost = errors.New("variables_url must resolve to a public address")
+
+// variablesHTTPClient fetches send-time template variables; its timeout comes from VARIABLES_TIMEOUT.
+// Its dialer checks every address actually connected to, so DNS answers and redirects cannot
+// point a lookup at the host's own network or a cloud metadata endpoint.
+var variablesHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+					return fmt.Errorf("%w: %s", errPrivateVariablesHost, host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, private in practice but not to net.IP
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicAddress reports whether ip is routable on the internet: not loopback, link-local
+// (including 169.254.169.254), private, shared, multicast or unspecified
+func publicAddress(ip net.IP) bool {
+	if variablesAllowPrivate {
+		return true
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// variablePattern matches {{name}} placeholders in message content
+var variablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// validateVariablesURL checks the optional variables_url of a schedule request
+func validateVariablesURL(raw string) *apiError {
+	if raw == "" {
+		return nil
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return &apiError{Code: codeInvalidParameter, Message: "variables_url must be an absolute http or https URL"}
+	}
+	// Host names are checked again on every connection; literal addresses can be refused now
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); (host == "localhost" && !variablesAllowPrivate) || (ip != nil && !publicAddress(ip)) {
+		return &apiError{Code: codeInvalidParameter, Message: errPrivateVariablesHost.Error()}
+	}
+	return nil
+}
+
+// resolveMessageVariables fetches the message's variables from its variables_url, passing the
+// recipient as phone_number, and keeps them on the message for renderContent. Every
+// placeholder in the content must be answered by the lookup.
+func resolveMessageVariables(message *Message) error {
+	if message.VariablesURL == "" {
+		return nil
+	}
+
+	target, err := url.Parse(message.VariablesURL)
+	if err != nil {
+		return fmt.Errorf("variables lookup failed: %w", err)
+	}
+	query := target.Query()
+	query.Set("phone_number", message.PhoneNumber)
+	target.RawQuery = query.Encode()
+
+	resp, err := variablesHTTPClient.Get(target.String())
+	if err != nil {
+		return fmt.Errorf("variables lookup failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("variables lookup failed: %s answered %d", target.Host, resp.StatusCode)
+	}
+
+	var raw map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, variablesMaxBytes)).Decode(&raw); err != nil {
+		return fmt.Errorf("variables lookup failed: response is not a JSON object: %w", err)
+	}
+
+	variables := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case string:
+			variables[name] = v
+		case nil:
+			variables[name] = ""
+		default:
+			encoded, _ := json.Marshal(v)
+			variables[name] = string(encoded)
+		}
+	}
+
+	var missing []string
+	for _, match := range variablePattern.FindAllStringSubmatch(message.Content, -1) {
+		if _, ok := variables[match[1]]; !ok {
+			missing = append(missing, match[1])
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("variables lookup returned no value for %s", strings.Join(missing, ", "))
+	}
+
+	message.variables = variables
+	return nil
+}
+
+// expandVariables replaces each {{name}} placeholder with its variable
+func expandVariables(content string, variables map[string]string) string {
+	return variablePattern.ReplaceAllStringFunc(content, func(placeholder string) string {
+		return variables[variablePattern.FindStringSubmatch(placeholder)[1]]
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxVariants caps the content variants of one schedule request
+const maxVariants = 10
+
+// MessageVariant is one A/B content variant; each recipient gets one, picked by weight
+type MessageVariant struct {
+	Name    string `json:"name"` // label stored on the message; defaults to A, B, C...
+	Content string `json:"content"`
+	Weight  int    `json:"weight"` // relative share of recipients; defaults to 1
+}
+
+// validateVariants checks a request's variants and fills in default names and weights
+func validateVariants(req *ScheduleMessageRequest) *apiError {
+	if len(req.Variants) == 0 {
+		return nil
+	}
+	if req.Content != "" || req.ContentSID != "" {
+		return &apiError{Code: codeInvalidParameter, Message: "variants replace content; do not give content or content_sid with them"}
+	}
+	if req.Recurrence != "" {
+		return &apiError{Code: codeInvalidParameter, Message: "variants cannot be used with recurrence"}
+	}
+	if len(req.Variants) < 2 || len(req.Variants) > maxVariants {
+		return &apiError{Code: codeInvalidParameter, Message: fmt.Sprintf("Give between 2 and %d variants", maxVariants)}
+	}
+
+	names := make(map[string]bool, len(req.Variants))
+	for i := range req.Variants {
+		variant := &req.Variants[i]
+		if variant.Name == "" {
+			variant.Name = string(rune('A' + i))
+		}
+		if variant.Weight == 0 {
+			variant.Weight = 1
+		}
+		if variant.Content == "" || variant.Weight < 0 || names[variant.Name] {
+			return &apiError{
+				Code:    codeInvalidParameter,
+				Message: "Each variant needs content, a positive weight and a unique name",
+				Details: gin.H{"variant": i},
+			}
+		}
+		if term, blocked := findBlockedTerm(variant.Content); blocked {
+			apiErr := blockedContentError(term)
+			apiErr.Details["variant"] = i
+			return apiErr
+		}
+		names[variant.Name] = true
+	}
+	return nil
+}
+
+// pickVariant draws one of the variants with probability proportional to its weight
+func pickVariant(variants []MessageVariant) MessageVariant {
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+	draw := rand.IntN(total)
+	for _, variant := range variants {
+		if draw < variant.Weight {
+			return variant
+		}
+		draw -= variant.Weight
+	}
+	return variants[len(variants)-1]
+}
+
+// variantResult is the status breakdown of one variant in the variant report
+type variantResult struct {
+	Variant   string `json:"variant"`
+	Total     int64  `json:"total"`
+	Sent      int64  `json:"sent"`
+	Delivered int64  `json:"delivered"`
+	Failed    int64  `json:"failed"` // failed and undelivered
+}
+
+// getVariantReport compares A/B variants by delivery outcome, for one campaign or for every
+// message scheduled in the range
+func getVariantReport(c *gin.Context) {
+	query := db.Scopes(forTenant(c)).Model(&Message{}).Where("variant <> ''")
+	if campaignID := c.Query("campaign_id"); campaignID != "" {
+		query = query.Where("campaign_id = ?", campaignID)
+	} else {
+		from, to, ok := parseReportRange(c)
+		if !ok {
+			return
+		}
+		query = query.Where("scheduled_at >= ? AND scheduled_at < ?", from, to)
+	}
+
+	results := []variantResult{}
+	err := query.
+		Select(`variant, COUNT(*) AS total,
+			SUM(CASE WHEN status IN ('sent', 'delivered', 'undelivered') THEN 1 ELSE 0 END) AS sent,
+			SUM(CASE WHEN status = 'delivered' THEN 1 ELSE 0 END) AS delivered,
+			SUM(CASE WHEN status IN ('failed', 'undelivered') THEN 1 ELSE 0 END) AS failed`).
+		Group("variant").
+		Order("variant ASC").
+		Scan(&results).Error
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to build variant report")
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{"variants": results})
+}
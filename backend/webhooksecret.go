@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	webhookSecretSetting         = "status_webhook_secret"
+	webhookPreviousSecretSetting = "status_webhook_previous_secret"
+	webhookPreviousUntilSetting  = "status_webhook_previous_until"
+)
+
+// webhookSecrets holds the status webhook signing secrets. After a rotation the previous secret
+// keeps signing alongside the current one until previousUntil, so receivers can switch over
+// without rejecting deliveries.
+type webhookSecrets struct {
+	mu            sync.RWMutex
+	current       string
+	previous      string
+	previousUntil time.Time
+	rotatedAt     *time.Time
+}
+
+var statusWebhookSecrets webhookSecrets
+
+// webhookRotationGrace is how long a demoted secret still signs, from STATUS_WEBHOOK_ROTATION_GRACE
+var webhookRotationGrace time.Duration
+
+// settingsCipher encrypts secrets kept in the settings table, from SETTINGS_ENCRYPTION_KEY;
+// nil stores them as plain text
+var settingsCipher cipher.AEAD
+
+// loadWebhookSecrets restores rotated secrets from the settings table. STATUS_WEBHOOK_SECRET only
+// seeds the current secret until the first rotation; after that the stored secret wins.
+func loadWebhookSecrets() {
+	webhookRotationGrace = getEnvDuration("STATUS_WEBHOOK_ROTATION_GRACE", 24*time.Hour)
+	if key := os.Getenv("SETTINGS_ENCRYPTION_KEY"); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		block, err := aes.NewCipher(sum[:])
+		if err != nil {
+			log.Fatal("Failed to set up SETTINGS_ENCRYPTION_KEY:", err)
+		}
+		if settingsCipher, err = cipher.NewGCM(block); err != nil {
+			log.Fatal("Failed to set up SETTINGS_ENCRYPTION_KEY:", err)
+		}
+	}
+
+	var settings []Setting
+	keys := []string{webhookSecretSetting, webhookPreviousSecretSetting, webhookPreviousUntilSetting}
+	if err := db.Where("key IN ?", keys).Find(&settings).Error; err != nil {
+		log.Fatal("Failed to load webhook secrets:", err)
+	}
+
+	secrets := &statusWebhookSecrets
+	secrets.current = os.Getenv("STATUS_WEBHOOK_SECRET")
+	plaintext := false
+	for _, setting := range settings {
+		if setting.Key != webhookPreviousUntilSetting && setting.Value != "" && !strings.HasPrefix(setting.Value, "enc:") {
+			plaintext = true
+		}
+		switch setting.Key {
+		case webhookSecretSetting:
+			value, err := openSetting(setting.Value)
+			if err != nil {
+				log.Fatal("Failed to decrypt the stored webhook secret; check SETTINGS_ENCRYPTION_KEY: ", err)
+			}
+			rotatedAt := setting.UpdatedAt
+			secrets.current, secrets.rotatedAt = value, &rotatedAt
+		case webhookPreviousSecretSetting:
+			value, err := openSetting(setting.Value)
+			if err != nil {
+				log.Fatal("Failed to decrypt the stored webhook secret; check SETTINGS_ENCRYPTION_KEY: ", err)
+			}
+			secrets.previous = value
+		case webhookPreviousUntilSetting:
+			secrets.previousUntil, _ = time.Parse(time.RFC3339, setting.Value)
+		}
+	}
+	if plaintext {
+		log.Println("WARNING: a rotated webhook secret is stored in plain text; set SETTINGS_ENCRYPTION_KEY and rotate again")
+	}
+}
+
+// signingSecrets returns the current secret and, during a rotation's grace period, the previous one
+func (s *webhookSecrets) signingSecrets() (string, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.previous != "" && time.Now().Before(s.previousUntil) {
+		return s.current, s.previous
+	}
+	return s.current, ""
+}
+
+// sealSetting encrypts a secret for the settings table when SETTINGS_ENCRYPTION_KEY is set
+func sealSetting(value string) (string, error) {
+	if settingsCipher == nil {
+		return value, nil
+	}
+	nonce := make([]byte, settingsCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := settingsCipher.Seal(nonce, nonce, []byte(value), nil)
+	return "enc:" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openSetting(value string) (string, error) {
+	if len(value) < 4 || value[:4] != "enc:" {
+		return value, nil
+	}
+	if settingsCipher == nil {
+		return "", errors.New("secret is encrypted but SETTINGS_ENCRYPTION_KEY is not set")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(value[4:])
+	if err != nil || len(sealed) < settingsCipher.NonceSize() {
+		return "", errors.New("malformed encrypted secret")
+	}
+	nonce, ciphertext := sealed[:settingsCipher.NonceSize()], sealed[settingsCipher.NonceSize():]
+	plain, err := settingsCipher.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// webhookSecretStatus describes the signing secrets for the admin endpoints. The secret itself
+// is only ever returned by the rotation that created it; this shows its last four characters.
+func webhookSecretStatus() gin.H {
+	s := &statusWebhookSecrets
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status := gin.H{"secret_set": s.current != "", "rotated_at": s.rotatedAt, "previous_active": false}
+	if len(s.current) > 8 {
+		status["secret_last4"] = s.current[len(s.current)-4:]
+	}
+	if s.previous != "" && time.Now().Before(s.previousUntil) {
+		status["previous_active"] = true
+		status["previous_expires_at"] = s.previousUntil
+	}
+	return status
+}
+
+// getWebhookSecret describes the current status webhook signing secret without revealing it; it
+// is shared by every tenant's webhook, so only admin keys reach it
+func getWebhookSecret(c *gin.Context) {
+	respond(c, http.StatusOK, webhookSecretStatus())
+}
+
+// rotateWebhookSecret generates a new signing secret and demotes the current one, which keeps
+// signing for STATUS_WEBHOOK_ROTATION_GRACE so receivers can be updated without downtime.
+// The response is the only place the new secret is shown. Rotated secrets are stored in the
+// settings table, so rotation is refused unless SETTINGS_ENCRYPTION_KEY encrypts them.
+func rotateWebhookSecret(c *gin.Context) {
+	if settingsCipher == nil {
+		respondErrorCode(c, http.StatusConflict, codeNotConfigured, "Set SETTINGS_ENCRYPTION_KEY before rotating, so stored webhook secrets are encrypted")
+		return
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to generate a secret")
+		return
+	}
+	next := "whsec_" + hex.EncodeToString(raw)
+
+	s := &statusWebhookSecrets
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	previousUntil := now.Add(webhookRotationGrace)
+	sealedNext, err := sealSetting(next)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to store the new secret")
+		return
+	}
+	sealedPrevious, err := sealSetting(s.current)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to store the new secret")
+		return
+	}
+	settings := []Setting{
+		{Key: webhookSecretSetting, Value: sealedNext, UpdatedAt: now},
+		{Key: webhookPreviousSecretSetting, Value: sealedPrevious, UpdatedAt: now},
+		{Key: webhookPreviousUntilSetting, Value: previousUntil.Format(time.RFC3339), UpdatedAt: now},
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&settings).Error
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to store the new secret")
+		return
+	}
+
+	s.previous, s.previousUntil = s.current, previousUntil
+	s.current, s.rotatedAt = next, &now
+	log.Printf("Status webhook secret rotated; the previous secret keeps signing until %s", previousUntil.Format(time.RFC3339))
+
+	status := gin.H{"secret": next, "rotated_at": now, "previous_active": s.previous != ""}
+	if s.previous != "" {
+		status["previous_expires_at"] = previousUntil
+	}
+	respond(c, http.StatusOK, status)
+}
@@ -14,7 +14,7 @@ const api = axios.create({
 api.interceptors.response.use(
   (response) => response,
   (error) => {
-    const message = error.response?.data?.error || error.message || 'An error occurred';
+    const message = error.response?.data?.error?.message || error.message || 'An error occurred';
     throw new Error(message);
   }
 );
@@ -38,7 +38,7 @@ export const scheduleMessage = async (data: ScheduleMessageRequest): Promise<Mes
 
 export const getMessages = async (): Promise<Message[]> => {
   const response = await api.get('/messages');
-  return response.data.messages;
+  return response.data.data;
 };
 
 export const updateMessage = async (id: number, data: UpdateMessageRequest): Promise<Message> => {